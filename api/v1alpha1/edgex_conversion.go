@@ -25,6 +25,7 @@ func (src *EdgeX) ConvertTo(dstRaw conversion.Hub) error {
 	// Transform metadata
 	dst := dstRaw.(*v1alpha2.EdgeX)
 	dst.ObjectMeta = src.ObjectMeta
+	dst.ObjectMeta.Annotations = copyAnnotations(src.ObjectMeta.Annotations)
 	dst.TypeMeta = src.TypeMeta
 	dst.TypeMeta.APIVersion = "device.openyurt.io/v1alpha2"
 
@@ -33,6 +34,10 @@ func (src *EdgeX) ConvertTo(dstRaw conversion.Hub) error {
 	dst.Spec.Security = false
 	dst.Spec.ImageRegistry = src.Spec.ImageRegistry
 	dst.Spec.PoolName = src.Spec.PoolName
+	// ClusterIP is the default of v1alpha1, which v1alpha2 gives the components without expose
+	if src.Spec.ServiceType != "" && src.Spec.ServiceType != corev1.ServiceTypeClusterIP {
+		dst.Spec.Expose = &v1alpha2.Expose{Type: src.Spec.ServiceType}
+	}
 
 	// Transform status
 	dst.Status.Ready = src.Status.Ready
@@ -59,6 +64,24 @@ func (src *EdgeX) ConvertTo(dstRaw conversion.Hub) error {
 		dst.ObjectMeta.Annotations["AdditionalServices"] = string(additionalService)
 	}
 
+	// Transform exposecomponents, the expose of v1alpha2 is kept in an annotation by ConvertFrom
+	if exposeComponents, ok := dst.ObjectMeta.Annotations["ExposeComponents"]; ok {
+		expose := &v1alpha2.Expose{}
+		if err := json.Unmarshal([]byte(exposeComponents), expose); err != nil {
+			return err
+		}
+		// The service type changed in v1alpha1 takes over the one kept
+		exposeType := expose.Type
+		if exposeType == "" {
+			exposeType = corev1.ServiceTypeClusterIP
+		}
+		if src.Spec.ServiceType != "" && src.Spec.ServiceType != exposeType {
+			expose.Type = src.Spec.ServiceType
+		}
+		dst.Spec.Expose = expose
+		delete(dst.ObjectMeta.Annotations, "ExposeComponents")
+	}
+
 	//TODO: Components
 
 	return nil
@@ -67,6 +90,7 @@ func (dst *EdgeX) ConvertFrom(srcRaw conversion.Hub) error {
 	// Transform metadata
 	src := srcRaw.(*v1alpha2.EdgeX)
 	dst.ObjectMeta = src.ObjectMeta
+	dst.ObjectMeta.Annotations = copyAnnotations(src.ObjectMeta.Annotations)
 	dst.TypeMeta = src.TypeMeta
 	dst.TypeMeta.APIVersion = "device.openyurt.io/v1alpha1"
 
@@ -75,6 +99,9 @@ func (dst *EdgeX) ConvertFrom(srcRaw conversion.Hub) error {
 	dst.Spec.ImageRegistry = src.Spec.ImageRegistry
 	dst.Spec.PoolName = src.Spec.PoolName
 	dst.Spec.ServiceType = corev1.ServiceTypeClusterIP
+	if src.Spec.Expose != nil && src.Spec.Expose.Type != "" {
+		dst.Spec.ServiceType = src.Spec.Expose.Type
+	}
 
 	// Transform status
 	dst.Status.Ready = src.Status.Ready
@@ -105,5 +132,26 @@ func (dst *EdgeX) ConvertFrom(srcRaw conversion.Hub) error {
 		dst.Spec.AdditionalService = additionalServices
 	}
 
+	// Transform exposecomponents, v1alpha1 only exposes all the components alike so the expose is kept
+	// in an annotation as it is, with the components exposed on their own and their node ports
+	delete(dst.ObjectMeta.Annotations, "ExposeComponents")
+	if src.Spec.Expose != nil {
+		exposeComponents, err := json.Marshal(src.Spec.Expose)
+		if err != nil {
+			return err
+		}
+		dst.ObjectMeta.Annotations["ExposeComponents"] = string(exposeComponents)
+	}
+
 	return nil
 }
+
+// copyAnnotations copies the annotations, so that the ones of the converted object are left as they are.
+// The copy is never nil, so that the annotations carrying the fields of the other version can be set.
+func copyAnnotations(annotations map[string]string) map[string]string {
+	copied := make(map[string]string, len(annotations)+1)
+	for k, v := range annotations {
+		copied[k] = v
+	}
+	return copied
+}
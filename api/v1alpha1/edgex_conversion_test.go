@@ -0,0 +1,122 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func TestConvertExposeRoundTrip(t *testing.T) {
+	cases := map[string]*v1alpha2.Expose{
+		"no expose":      nil,
+		"all clusterip":  {Type: corev1.ServiceTypeClusterIP},
+		"all nodeport":   {Type: corev1.ServiceTypeNodePort},
+		"no type at all": {},
+		"pinned node ports": {
+			Type: corev1.ServiceTypeClusterIP,
+			Components: []v1alpha2.ComponentExpose{{
+				Name:  "edgex-ui-go",
+				Type:  corev1.ServiceTypeNodePort,
+				Ports: []v1alpha2.ExposePort{{Port: 4000, NodePort: 30400}},
+			}},
+		},
+	}
+	for name, expose := range cases {
+		hub := &v1alpha2.EdgeX{
+			ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Annotations: map[string]string{"owner": "beijing"}},
+			Spec:       v1alpha2.EdgeXSpec{Version: "jakarta", PoolName: "beijing", Expose: expose},
+		}
+		spoke := &EdgeX{}
+		if err := spoke.ConvertFrom(hub); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(hub.Annotations) != 1 {
+			t.Errorf("%s: the annotations of the hub should be left as they are, got %v", name, hub.Annotations)
+		}
+
+		converted := &v1alpha2.EdgeX{}
+		if err := spoke.ConvertTo(converted); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !apiequality.Semantic.DeepEqual(converted.Spec, hub.Spec) {
+			t.Errorf("%s: expected the spec %+v after the round trip, got %+v", name, hub.Spec, converted.Spec)
+		}
+		if _, ok := converted.Annotations["ExposeComponents"]; ok || converted.Annotations["owner"] != "beijing" {
+			t.Errorf("%s: unexpected annotations %v", name, converted.Annotations)
+		}
+		if _, ok := spoke.Annotations["ExposeComponents"]; ok != (expose != nil) {
+			t.Errorf("%s: unexpected annotations of the spoke %v", name, spoke.Annotations)
+		}
+	}
+}
+
+func TestConvertServiceTypeChange(t *testing.T) {
+	hub := &v1alpha2.EdgeX{
+		Spec: v1alpha2.EdgeXSpec{Expose: &v1alpha2.Expose{
+			Components: []v1alpha2.ComponentExpose{{Name: "edgex-ui-go", Type: corev1.ServiceTypeNodePort}},
+		}},
+	}
+	spoke := &EdgeX{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if spoke.Spec.ServiceType != corev1.ServiceTypeClusterIP {
+		t.Fatalf("expected ClusterIP by default, got %s", spoke.Spec.ServiceType)
+	}
+
+	// the service type changed in v1alpha1 takes over, the components are kept
+	spoke.Spec.ServiceType = corev1.ServiceTypeLoadBalancer
+	converted := &v1alpha2.EdgeX{}
+	if err := spoke.ConvertTo(converted); err != nil {
+		t.Fatal(err)
+	}
+	if expose := converted.Spec.Expose; expose == nil || expose.Type != corev1.ServiceTypeLoadBalancer || len(expose.Components) != 1 {
+		t.Fatalf("unexpected expose %+v", expose)
+	}
+}
+
+func TestConvertAdditionalComponents(t *testing.T) {
+	spoke := &EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing"},
+		Spec: EdgeXSpec{
+			Version:           "jakarta",
+			AdditionalService: []ServiceTemplateSpec{{ObjectMeta: metav1.ObjectMeta{Name: "edgex-device-virtual"}}},
+		},
+	}
+	// the annotations carrying the additional components are set even when there is none
+	hub := &v1alpha2.EdgeX{}
+	if err := spoke.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hub.Annotations["AdditionalServices"]; !ok || spoke.Annotations != nil {
+		t.Fatalf("unexpected annotations %v of the hub and %v of the spoke", hub.Annotations, spoke.Annotations)
+	}
+
+	converted := &EdgeX{}
+	if err := converted.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if len(converted.Spec.AdditionalService) != 1 || converted.Spec.AdditionalService[0].Name != "edgex-device-virtual" {
+		t.Fatalf("unexpected additional services %+v", converted.Spec.AdditionalService)
+	}
+}
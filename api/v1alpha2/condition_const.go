@@ -27,10 +27,72 @@ const (
 	ConfigmapProvisioningReason = "ConfigmapProvisioning"
 
 	ConfigmapProvisioningFailedReason = "ConfigmapProvisioningFailed"
+
+	ConfigmapProvisionedReason = "ConfigmapProvisioned"
 	// ComponentAvailableCondition documents the status of the EdgeX component.
 	ComponentAvailableCondition clusterv1.ConditionType = "ComponentAvailable"
 
 	ComponentProvisioningReason = "ComponentProvisioning"
 
 	ComponentProvisioningFailedReason = "ComponentProvisioningFailed"
+
+	ServiceCreatedReason = "ServiceCreated"
+
+	YurtAppSetCreatedReason = "YurtAppSetCreated"
+
+	PoolJoinedReason = "PoolJoined"
+
+	PoolLeftReason = "PoolLeft"
+
+	ComponentReadyReason = "ComponentReady"
+
+	ComponentUnreadyReason = "ComponentUnready"
+	// InfrastructureReadyCondition documents the readiness of the registry and the database, e.g. redis and consul.
+	InfrastructureReadyCondition clusterv1.ConditionType = "InfrastructureReady"
+	// SecurityServicesReadyCondition documents the readiness of the security components.
+	SecurityServicesReadyCondition clusterv1.ConditionType = "SecurityServicesReady"
+	// CoreServicesReadyCondition documents the readiness of the core, support and system management services.
+	CoreServicesReadyCondition clusterv1.ConditionType = "CoreServicesReady"
+	// DeviceServicesReadyCondition documents the readiness of the device services.
+	DeviceServicesReadyCondition clusterv1.ConditionType = "DeviceServicesReady"
+	// AppServicesReadyCondition documents the readiness of the application services.
+	AppServicesReadyCondition clusterv1.ConditionType = "AppServicesReady"
+
+	ComponentsNotReadyReason = "ComponentsNotReady"
+	// EdgeXAPIHealthyCondition documents the health of the v2 REST API of the services.
+	EdgeXAPIHealthyCondition clusterv1.ConditionType = "EdgeXAPIHealthy"
+
+	APIUnhealthyReason = "APIUnhealthy"
+	// MetadataSyncedCondition documents the sync of a device, a device profile or a device service to core-metadata.
+	MetadataSyncedCondition clusterv1.ConditionType = "MetadataSynced"
+
+	MetadataUnavailableReason = "MetadataUnavailable"
+
+	MetadataSyncFailedReason = "MetadataSyncFailed"
+	// UpgradeInProgressCondition documents the upgrade of the EdgeX version.
+	UpgradeInProgressCondition clusterv1.ConditionType = "UpgradeInProgress"
+
+	UpgradeStartedReason = "UpgradeStarted"
+
+	UpgradeWaveStartedReason = "UpgradeWaveStarted"
+
+	UpgradeSucceededReason = "UpgradeSucceeded"
+
+	UpgradeRolledBackReason = "UpgradeRolledBack"
+	// DeletingCondition documents the release of the resources of the EdgeX being deleted.
+	DeletingCondition clusterv1.ConditionType = "Deleting"
+
+	WaitingForPodsDeletionReason = "WaitingForPodsDeletion"
+
+	ReleasingResourcesReason = "ReleasingResources"
+
+	OrphaningResourcesReason = "OrphaningResources"
+	// DriftDetectedCondition documents the changes of the generated YurtAppSets made outside of the EdgeX.
+	DriftDetectedCondition clusterv1.ConditionType = "DriftDetected"
+
+	DriftCorrectedReason = "DriftCorrected"
+
+	DriftIgnoredReason = "DriftIgnored"
+
+	NoDriftReason = "NoDrift"
 )
@@ -0,0 +1,151 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	// MetadataFinalizer removes the devices, the device profiles and the device services from core-metadata
+	MetadataFinalizer = "metadata.edgexfoundry.org"
+)
+
+// AdminState of a device or a device service, a locked one is not operated by EdgeX
+// +kubebuilder:validation:Enum=LOCKED;UNLOCKED
+type AdminState string
+
+const (
+	Locked   AdminState = "LOCKED"
+	Unlocked AdminState = "UNLOCKED"
+)
+
+// OperatingState of a device as reported by its device service
+type OperatingState string
+
+const (
+	Up      OperatingState = "UP"
+	Down    OperatingState = "DOWN"
+	Unknown OperatingState = "UNKNOWN"
+)
+
+// AutoEvent defines a device resource or a device command read periodically
+type AutoEvent struct {
+	// Interval of the reading, e.g. 10s
+	Interval string `json:"interval"`
+
+	// OnChange only sends an event when the reading changes
+	// +optional
+	OnChange bool `json:"onChange,omitempty"`
+
+	SourceName string `json:"sourceName"`
+}
+
+// ProtocolProperties defines how a protocol reaches the device
+type ProtocolProperties map[string]string
+
+// DeviceProperties defines a device as core-metadata knows it
+type DeviceProperties struct {
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// AdminState is owned by the spec, the changes made in core-metadata are reverted
+	// +kubebuilder:default=UNLOCKED
+	// +optional
+	AdminState AdminState `json:"adminState,omitempty"`
+
+	// +optional
+	Labels []string `json:"labels,omitempty"`
+
+	// ServiceName is the name of the DeviceService operating the device
+	ServiceName string `json:"serviceName"`
+
+	// ProfileName is the name of the DeviceProfile of the device
+	ProfileName string `json:"profileName"`
+
+	// +optional
+	AutoEvents []AutoEvent `json:"autoEvents,omitempty"`
+
+	Protocols map[string]ProtocolProperties `json:"protocols"`
+}
+
+// DeviceSpec defines the desired state of Device
+type DeviceSpec struct {
+	// PoolName binds the device to the EdgeX of the pool in the namespace
+	// +kubebuilder:validation:MinLength=1
+	PoolName string `json:"poolName"`
+
+	DeviceProperties `json:",inline"`
+}
+
+// DeviceStatus defines the observed state of Device
+type DeviceStatus struct {
+	// EdgeXID is the id of the device in core-metadata
+	// +optional
+	EdgeXID string `json:"edgexId,omitempty"`
+
+	// AdminState is the admin state in core-metadata, the one of the spec once it is synced
+	// +optional
+	AdminState AdminState `json:"adminState,omitempty"`
+
+	// OperatingState is the operating state reported by the device service
+	// +optional
+	OperatingState OperatingState `json:"operatingState,omitempty"`
+
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=dev
+//+kubebuilder:printcolumn:name="POOL",type="string",JSONPath=".spec.poolName"
+//+kubebuilder:printcolumn:name="SYNCED",type="string",JSONPath=".status.conditions[?(@.type=='MetadataSynced')].status"
+//+kubebuilder:printcolumn:name="ADMINSTATE",type="string",JSONPath=".status.adminState"
+//+kubebuilder:printcolumn:name="OPERATINGSTATE",type="string",JSONPath=".status.operatingState"
+//+kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// Device is the Schema for the devices API, it is synced to core-metadata of the EdgeX of its pool
+type Device struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DeviceSpec   `json:"spec,omitempty"`
+	Status DeviceStatus `json:"status,omitempty"`
+}
+
+func (d *Device) GetConditions() clusterv1.Conditions {
+	return d.Status.Conditions
+}
+
+func (d *Device) SetConditions(conditions clusterv1.Conditions) {
+	d.Status.Conditions = conditions
+}
+
+//+kubebuilder:object:root=true
+
+// DeviceList contains a list of Device
+type DeviceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Device `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Device{}, &DeviceList{})
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// ResourceProperties defines the value of a device resource
+type ResourceProperties struct {
+	ValueType string `json:"valueType"`
+
+	// +kubebuilder:validation:Enum=R;W;RW;WR
+	ReadWrite string `json:"readWrite"`
+
+	// +optional
+	Units string `json:"units,omitempty"`
+	// +optional
+	Minimum string `json:"minimum,omitempty"`
+	// +optional
+	Maximum string `json:"maximum,omitempty"`
+	// +optional
+	DefaultValue string `json:"defaultValue,omitempty"`
+	// +optional
+	Mask string `json:"mask,omitempty"`
+	// +optional
+	Shift string `json:"shift,omitempty"`
+	// +optional
+	Scale string `json:"scale,omitempty"`
+	// +optional
+	Offset string `json:"offset,omitempty"`
+	// +optional
+	Base string `json:"base,omitempty"`
+	// +optional
+	Assertion string `json:"assertion,omitempty"`
+	// +optional
+	MediaType string `json:"mediaType,omitempty"`
+}
+
+// DeviceResource defines a value a device reads or writes
+type DeviceResource struct {
+	Name string `json:"name"`
+
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// +optional
+	IsHidden bool `json:"isHidden,omitempty"`
+
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	Properties ResourceProperties `json:"properties"`
+
+	// Attributes are passed to the device service to locate the value on the device
+	// +optional
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// ResourceOperation defines a device resource read or written by a device command
+type ResourceOperation struct {
+	DeviceResource string `json:"deviceResource"`
+
+	// +optional
+	DefaultValue string `json:"defaultValue,omitempty"`
+
+	// +optional
+	Mappings map[string]string `json:"mappings,omitempty"`
+}
+
+// DeviceCommand defines a command which reads or writes several device resources at once
+type DeviceCommand struct {
+	Name string `json:"name"`
+
+	// +optional
+	IsHidden bool `json:"isHidden,omitempty"`
+
+	// +kubebuilder:validation:Enum=R;W;RW;WR
+	ReadWrite string `json:"readWrite"`
+
+	ResourceOperations []ResourceOperation `json:"resourceOperations"`
+}
+
+// DeviceProfileProperties defines a device profile as core-metadata knows it
+type DeviceProfileProperties struct {
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// +optional
+	Manufacturer string `json:"manufacturer,omitempty"`
+
+	// +optional
+	Model string `json:"model,omitempty"`
+
+	// +optional
+	Labels []string `json:"labels,omitempty"`
+
+	// +optional
+	DeviceResources []DeviceResource `json:"deviceResources,omitempty"`
+
+	// +optional
+	DeviceCommands []DeviceCommand `json:"deviceCommands,omitempty"`
+}
+
+// DeviceProfileSpec defines the desired state of DeviceProfile
+type DeviceProfileSpec struct {
+	// PoolName binds the device profile to the EdgeX of the pool in the namespace
+	// +kubebuilder:validation:MinLength=1
+	PoolName string `json:"poolName"`
+
+	DeviceProfileProperties `json:",inline"`
+}
+
+// DeviceProfileStatus defines the observed state of DeviceProfile
+type DeviceProfileStatus struct {
+	// EdgeXID is the id of the device profile in core-metadata
+	// +optional
+	EdgeXID string `json:"edgexId,omitempty"`
+
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=dp
+//+kubebuilder:printcolumn:name="POOL",type="string",JSONPath=".spec.poolName"
+//+kubebuilder:printcolumn:name="SYNCED",type="string",JSONPath=".status.conditions[?(@.type=='MetadataSynced')].status"
+//+kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// DeviceProfile is the Schema for the deviceprofiles API, it is synced to core-metadata of the EdgeX of its pool
+type DeviceProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DeviceProfileSpec   `json:"spec,omitempty"`
+	Status DeviceProfileStatus `json:"status,omitempty"`
+}
+
+func (p *DeviceProfile) GetConditions() clusterv1.Conditions {
+	return p.Status.Conditions
+}
+
+func (p *DeviceProfile) SetConditions(conditions clusterv1.Conditions) {
+	p.Status.Conditions = conditions
+}
+
+//+kubebuilder:object:root=true
+
+// DeviceProfileList contains a list of DeviceProfile
+type DeviceProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DeviceProfile `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DeviceProfile{}, &DeviceProfileList{})
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// DeviceServiceProperties defines a device service as core-metadata knows it
+type DeviceServiceProperties struct {
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// +optional
+	Labels []string `json:"labels,omitempty"`
+
+	// BaseAddress is the URL core-command reaches the device service at
+	BaseAddress string `json:"baseAddress"`
+
+	// AdminState is owned by the spec, the changes made in core-metadata are reverted
+	// +kubebuilder:default=UNLOCKED
+	// +optional
+	AdminState AdminState `json:"adminState,omitempty"`
+}
+
+// DeviceServiceSpec defines the desired state of DeviceService
+type DeviceServiceSpec struct {
+	// PoolName binds the device service to the EdgeX of the pool in the namespace
+	// +kubebuilder:validation:MinLength=1
+	PoolName string `json:"poolName"`
+
+	DeviceServiceProperties `json:",inline"`
+}
+
+// DeviceServiceStatus defines the observed state of DeviceService
+type DeviceServiceStatus struct {
+	// EdgeXID is the id of the device service in core-metadata
+	// +optional
+	EdgeXID string `json:"edgexId,omitempty"`
+
+	// AdminState is the admin state in core-metadata, the one of the spec once it is synced
+	// +optional
+	AdminState AdminState `json:"adminState,omitempty"`
+
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=dsvc
+//+kubebuilder:printcolumn:name="POOL",type="string",JSONPath=".spec.poolName"
+//+kubebuilder:printcolumn:name="SYNCED",type="string",JSONPath=".status.conditions[?(@.type=='MetadataSynced')].status"
+//+kubebuilder:printcolumn:name="ADMINSTATE",type="string",JSONPath=".status.adminState"
+//+kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// DeviceService is the Schema for the deviceservices API, it is synced to core-metadata of the EdgeX of its pool
+type DeviceService struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DeviceServiceSpec   `json:"spec,omitempty"`
+	Status DeviceServiceStatus `json:"status,omitempty"`
+}
+
+func (s *DeviceService) GetConditions() clusterv1.Conditions {
+	return s.Status.Conditions
+}
+
+func (s *DeviceService) SetConditions(conditions clusterv1.Conditions) {
+	s.Status.Conditions = conditions
+}
+
+//+kubebuilder:object:root=true
+
+// DeviceServiceList contains a list of DeviceService
+type DeviceServiceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DeviceService `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DeviceService{}, &DeviceServiceList{})
+}
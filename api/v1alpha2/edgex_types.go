@@ -17,6 +17,8 @@ limitations under the License.
 package v1alpha2
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
@@ -26,31 +28,313 @@ const (
 	EdgexFinalizer = "edgex.edgexfoundry.org"
 
 	LabelEdgeXGenerate = "www.edgexfoundry.org/generate"
+
+	// LabelEdgeXName marks the objects generated for an EdgeX which are not owned by it
+	LabelEdgeXName = "device.openyurt.io/edgex-name"
+
+	// LabelEdgeXOrphaned marks the objects orphaned by a deleted EdgeX, its value is the former LabelEdgeXGenerate
+	LabelEdgeXOrphaned = "device.openyurt.io/orphaned"
+
+	// AnnotationOrphanedPool records the pool of the EdgeX which orphaned the object
+	AnnotationOrphanedPool = "device.openyurt.io/orphaned-pool"
+
+	// AnnotationOrphanedEdgeX records the name of the EdgeX which orphaned the object
+	AnnotationOrphanedEdgeX = "device.openyurt.io/orphaned-edgex"
+
+	// AnnotationIgnoreDrift keeps the hand edits of a generated YurtAppSet when it is "true"
+	AnnotationIgnoreDrift = "device.openyurt.io/ignore-drift"
+
+	// AnnotationOverrideUpgradePath allows the version to be changed against the upgrade path when it is "true"
+	AnnotationOverrideUpgradePath = "device.openyurt.io/override-upgrade-path"
+)
+
+// DeletionPolicy defines what happens to the workloads of an EdgeX when it is deleted
+// +kubebuilder:validation:Enum=Delete;Orphan
+type DeletionPolicy string
+
+const (
+	// DeletionDelete removes the pool of the EdgeX and deletes the objects it owns solely
+	DeletionDelete DeletionPolicy = "Delete"
+	// DeletionOrphan keeps the pool running, the objects are left for a new EdgeX of the pool to adopt.
+	// The configmaps, claims, exposed services and ingress are named after the EdgeX, so only a new EdgeX
+	// of the same name adopts them.
+	DeletionOrphan DeletionPolicy = "Orphan"
 )
 
 // Component defines the components of EdgeX
 type Component struct {
 	Name string `json:"name"`
 
+	// Enabled deploys the component, set it to false to leave the component of the version out of the pool
+	// +optional
+	// +kubebuilder:default=true
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Image overrides the image of the component defined by the version
 	// +optional
 	Image string `json:"image,omitempty"`
 
-	// Replicas int32 `json:"replicas,omitempty"`
+	// Env is merged over the environment variables of the main container of the component
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Replicas of the component in the pool, 1 by default
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Resources replaces the resources of the main container of the component
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// NodeSelector is merged over the node selector of the component, the component
+	// is always scheduled in the pool of the EdgeX
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations are appended to the tolerations of the component
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity replaces the affinity of the component
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+}
+
+// PersistenceRetainPolicy defines what happens to the persistent volume claims when the EdgeX is deleted
+// +kubebuilder:validation:Enum=Retain;Delete
+type PersistenceRetainPolicy string
+
+const (
+	// PersistenceRetain keeps the persistent volume claims after the EdgeX is deleted
+	PersistenceRetain PersistenceRetainPolicy = "Retain"
+	// PersistenceDelete deletes the persistent volume claims with the EdgeX
+	PersistenceDelete PersistenceRetainPolicy = "Delete"
+)
+
+// ComponentPersistence defines the persistent storage of a stateful component
+type ComponentPersistence struct {
+	Name string `json:"name"`
+
+	// Volumes lists the volumes of the component switched to persistent volume claims,
+	// the data volume of edgex-redis, edgex-core-consul, edgex-vault and edgex-kong-db by default
+	// +optional
+	Volumes []string `json:"volumes,omitempty"`
+
+	// StorageClassName of the persistent volume claims, the default storage class is used when it is empty
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// Size of each persistent volume claim
+	Size resource.Quantity `json:"size"`
+}
+
+// Persistence defines the persistent storage of the stateful components
+type Persistence struct {
+	// +optional
+	Components []ComponentPersistence `json:"components,omitempty"`
+
+	// RetainPolicy of the persistent volume claims, Retain by default
+	// +optional
+	RetainPolicy PersistenceRetainPolicy `json:"retainPolicy,omitempty"`
+}
+
+// ExposePort pins the node port of a port of the component service
+type ExposePort struct {
+	// Port of the component service
+	Port int32 `json:"port"`
+
+	// NodePort of the port, allocated by the cluster when it is not set
+	// +optional
+	NodePort int32 `json:"nodePort,omitempty"`
+}
+
+// ComponentExpose defines how a component is exposed
+type ComponentExpose struct {
+	Name string `json:"name"`
+
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	Type corev1.ServiceType `json:"type"`
+
+	// +optional
+	Ports []ExposePort `json:"ports,omitempty"`
+}
+
+// Expose defines how the components are exposed, each exposed component gets a service
+// of its own which only selects the pods in the pool of the EdgeX
+type Expose struct {
+	// Type exposes all the components with a service, except the ones listed in Components
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// +optional
+	Components []ComponentExpose `json:"components,omitempty"`
+}
+
+// IngressPath routes a path prefix to a component
+type IngressPath struct {
+	// Path prefix routed to the component
+	Path string `json:"path"`
+
+	Component string `json:"component"`
+
+	// Port of the component service, the first port of the service by default
+	// +optional
+	Port int32 `json:"port,omitempty"`
+}
+
+// Ingress defines the ingress routing to the components in the pool of the EdgeX
+type Ingress struct {
+	// +optional
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+
+	// Host of the rule, all the hosts are matched when it is empty
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// TLSSecretName references the secret holding the certificate of the host
+	// +optional
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Paths routed by the ingress, "/" is routed to the gateway (edgex-kong, or kong up to hanoi)
+	// with security and to edgex-ui-go without it when it is empty
+	// +optional
+	Paths []IngressPath `json:"paths,omitempty"`
+}
+
+// APIHealthCheck defines the probing of the v2 REST API of the services in the pool of the EdgeX,
+// the probed components are exposed by a ClusterIP service at least
+type APIHealthCheck struct {
+	// Components to probe, the core services by default
+	// +optional
+	Components []string `json:"components,omitempty"`
+
+	// Period of the probing, 1 minute by default
+	// +optional
+	Period *metav1.Duration `json:"period,omitempty"`
+
+	// Timeout of each request, 5 seconds by default
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
 }
 
 // EdgeXSpec defines the desired state of EdgeX
 type EdgeXSpec struct {
 	Version string `json:"version,omitempty"`
 
+	// ImageRegistry replaces the registry of the images defined by the version,
+	// e.g. a local mirror for air-gapped sites
 	ImageRegistry string `json:"imageRegistry,omitempty"`
 
 	PoolName string `json:"poolName,omitempty"`
 
+	// Components customizes the components of the version. All the components of the version are
+	// deployed unless their entry is not enabled, the other fields of an entry override their settings.
 	// +optional
 	Components []Component `json:"components,omitempty"`
 
 	// +optional
 	Security bool `json:"security,omitempty"`
+
+	// Env is merged over the common variables of the version, only the plain values are supported
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Expose exposes the components out of the cluster
+	// +optional
+	Expose *Expose `json:"expose,omitempty"`
+
+	// Ingress routes the traffic out of the cluster to the components of the pool
+	// +optional
+	Ingress *Ingress `json:"ingress,omitempty"`
+
+	// Persistence switches the stateful components to persistent volume claims
+	// +optional
+	Persistence *Persistence `json:"persistence,omitempty"`
+
+	// UpgradeTimeout is how long an upgrade of the version may take before it is rolled back,
+	// 10 minutes by default
+	// +optional
+	UpgradeTimeout *metav1.Duration `json:"upgradeTimeout,omitempty"`
+
+	// DeletionPolicy of the workloads when the EdgeX is deleted, Delete by default
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// APIHealthCheck probes /api/v2/ping and /api/v2/config of the services, the pods being ready
+	// is all that is checked when it is not set
+	// +optional
+	APIHealthCheck *APIHealthCheck `json:"apiHealthCheck,omitempty"`
+}
+
+// ComponentStatus defines the observed state of a component in the pool of EdgeX
+type ComponentStatus struct {
+	Name string `json:"name"`
+
+	// Ready indicates the service and the deployment of the component are ready
+	// +optional
+	Ready bool `json:"ready,omitempty"`
+
+	// Image is the image actually deployed in the pool
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// +optional
+	ServiceName string `json:"serviceName,omitempty"`
+
+	// +optional
+	ClusterIP string `json:"clusterIP,omitempty"`
+
+	// LastTransitionTime is the last time the readiness of the component changed
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// ServiceHealth defines the result of the last probe of the v2 REST API of a service
+type ServiceHealth struct {
+	Name string `json:"name"`
+
+	// Healthy indicates both /api/v2/ping and /api/v2/config answered as expected
+	// +optional
+	Healthy bool `json:"healthy,omitempty"`
+
+	// Latency of /api/v2/ping
+	// +optional
+	Latency metav1.Duration `json:"latency,omitempty"`
+
+	// Message explains why the service is not healthy
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// +optional
+	LastProbeTime metav1.Time `json:"lastProbeTime,omitempty"`
+}
+
+// UpgradeStatus defines the progress of an upgrade from one version to another
+type UpgradeStatus struct {
+	FromVersion string `json:"fromVersion"`
+
+	ToVersion string `json:"toVersion"`
+
+	// StartTime is when the upgrade started, the upgrade is rolled back once it takes too long
+	StartTime metav1.Time `json:"startTime"`
+
+	// Wave is the tier of components being rolled out
+	// +optional
+	Wave string `json:"wave,omitempty"`
+
+	// RolledBack indicates the upgrade timed out and the components are rolled back to FromVersion
+	// +optional
+	RolledBack bool `json:"rolledBack,omitempty"`
 }
 
 // EdgeXStatus defines the observed state of EdgeX
@@ -61,12 +345,37 @@ type EdgeXStatus struct {
 	// +optional
 	Initialized bool `json:"initialized,omitempty"`
 
+	// ObservedGeneration is the generation of the EdgeX last reconciled
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// CatalogRevision is the resourceVersion of the EdgeXVersion last applied, so that a change
+	// of the catalog is not taken for a drift of the components
+	// +optional
+	CatalogRevision string `json:"catalogRevision,omitempty"`
+
 	// +optional
 	ReadyComponentNum int32 `json:"readyComponentNum,omitempty"`
 
 	// +optional
 	UnreadyComponentNum int32 `json:"unreadyComponentNum,omitempty"`
 
+	// Components is the status of each component in the pool
+	// +optional
+	Components []ComponentStatus `json:"components,omitempty"`
+
+	// Services is the health of the v2 REST API of the probed services
+	// +optional
+	Services []ServiceHealth `json:"services,omitempty"`
+
+	// Version is the version deployed in the pool, it only moves to spec.version once an upgrade completes
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Upgrade is the upgrade in progress or rolled back
+	// +optional
+	Upgrade *UpgradeStatus `json:"upgrade,omitempty"`
+
 	// Current Edgex state
 	// +optional
 	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
@@ -98,6 +407,28 @@ func (c *EdgeX) SetConditions(conditions clusterv1.Conditions) {
 	c.Status.Conditions = conditions
 }
 
+// Deploys reports whether the component of the version is deployed for the EdgeX,
+// see EdgeXSpec.Components.
+func (c *EdgeX) Deploys(name string) bool {
+	for i := range c.Spec.Components {
+		component := &c.Spec.Components[i]
+		if component.Name == name && component.Enabled != nil && !*component.Enabled {
+			return false
+		}
+	}
+	return true
+}
+
+// DefaultIngressPaths returns the paths routed when Ingress.Paths is empty, "/" is routed to the gateway
+// with security, which is named kong up to hanoi, and to edgex-ui-go without it. Only the paths to the
+// components deployed are routed.
+func DefaultIngressPaths(security bool) []IngressPath {
+	if security {
+		return []IngressPath{{Path: "/", Component: "edgex-kong"}, {Path: "/", Component: "kong"}}
+	}
+	return []IngressPath{{Path: "/", Component: "edgex-ui-go"}}
+}
+
 //+kubebuilder:object:root=true
 
 // EdgeXList contains a list of EdgeX
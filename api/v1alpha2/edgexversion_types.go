@@ -0,0 +1,147 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ComponentCategory groups the components of a release by the part of EdgeX they belong to
+// +kubebuilder:validation:Enum=Infrastructure;Security;Core;Device;App
+type ComponentCategory string
+
+const (
+	// CategoryInfrastructure is the registry and the database, e.g. edgex-core-consul and edgex-redis
+	CategoryInfrastructure ComponentCategory = "Infrastructure"
+	// CategorySecurity is the secret store and the API gateway
+	CategorySecurity ComponentCategory = "Security"
+	// CategoryCore is the core, support and system management services
+	CategoryCore ComponentCategory = "Core"
+	// CategoryDevice is the device services
+	CategoryDevice ComponentCategory = "Device"
+	// CategoryApp is the application services, the rules engine and the UI
+	CategoryApp ComponentCategory = "App"
+)
+
+// VersionComponent defines how a component of an EdgeX release is deployed
+type VersionComponent struct {
+	Name string `json:"name"`
+
+	// Category of the component, guessed from its name when it is empty
+	// +optional
+	Category ComponentCategory `json:"category,omitempty"`
+
+	// DependsOn lists the components which must be ready in the pool before the component is created
+	// +optional
+	DependsOn []string `json:"dependsOn,omitempty"`
+
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	Service *corev1.ServiceSpec `json:"service,omitempty"`
+
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	Deployment *appsv1.DeploymentSpec `json:"deployment,omitempty"`
+}
+
+// ResolvedCategory returns the category of the component, the catalogs without one
+// are categorized by the name of the component.
+func (c *VersionComponent) ResolvedCategory() ComponentCategory {
+	if c.Category != "" {
+		return c.Category
+	}
+	name := c.Name
+	switch {
+	case strings.Contains(name, "redis") || strings.Contains(name, "consul"):
+		return CategoryInfrastructure
+	case strings.Contains(name, "security") || strings.Contains(name, "vault") || strings.Contains(name, "kong") ||
+		strings.Contains(name, "secret") || strings.Contains(name, "proxy"):
+		return CategorySecurity
+	case strings.Contains(name, "-core-") || strings.Contains(name, "-support-") || strings.Contains(name, "-sys-mgmt-"):
+		return CategoryCore
+	case strings.Contains(name, "-device-"):
+		return CategoryDevice
+	}
+	return CategoryApp
+}
+
+// VersionCatalog defines the configmaps and the components of an EdgeX release
+type VersionCatalog struct {
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	ConfigMaps []corev1.ConfigMap `json:"configMaps,omitempty"`
+
+	// +optional
+	Components []VersionComponent `json:"components,omitempty"`
+}
+
+// EdgeXVersionSpec defines the catalog of an EdgeX release, the name of the EdgeXVersion is the release name
+type EdgeXVersionSpec struct {
+	// Default marks the version used by the EdgeX which does not specify one
+	// +optional
+	Default bool `json:"default,omitempty"`
+
+	// Security is the catalog used when the security of EdgeX is enabled
+	// +optional
+	Security VersionCatalog `json:"security,omitempty"`
+
+	// NoSecty is the catalog used when the security of EdgeX is disabled
+	// +optional
+	NoSecty VersionCatalog `json:"nosecty,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:path=edgexversions,scope=Cluster
+//+kubebuilder:resource:shortName=edgexv
+//+kubebuilder:printcolumn:name="DEFAULT",type="boolean",JSONPath=".spec.default",description="The default version"
+//+kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// EdgeXVersion is the Schema for the edgexversions API
+type EdgeXVersion struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec EdgeXVersionSpec `json:"spec,omitempty"`
+}
+
+// Catalog returns the catalog of the version for the given security mode.
+func (v *EdgeXVersion) Catalog(security bool) *VersionCatalog {
+	if security {
+		return &v.Spec.Security
+	}
+	return &v.Spec.NoSecty
+}
+
+//+kubebuilder:object:root=true
+
+// EdgeXVersionList contains a list of EdgeXVersion
+type EdgeXVersionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EdgeXVersion `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&EdgeXVersion{}, &EdgeXVersionList{})
+}
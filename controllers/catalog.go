@@ -0,0 +1,351 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+const (
+	// LabelEdgeXCatalog marks the configmaps which carry extra EdgeX version catalogs
+	LabelEdgeXCatalog = "device.openyurt.io/edgex-catalog"
+
+	// The keys of a catalog configmap, named after the files in EdgeXConfig
+	CatalogSecurityKey = "config.json"
+	CatalogNoSectyKey  = "config-nosecty.json"
+	CatalogManifestKey = "manifest.yaml"
+
+	// InvalidCatalogReason is the reason of the event recorded on a catalog configmap which is skipped
+	InvalidCatalogReason = "InvalidCatalog"
+)
+
+// edgexVersion returns the EdgeXVersion of the version.
+func edgexVersion(ctx context.Context, c client.Reader, name string) (*devicev1alpha2.EdgeXVersion, error) {
+	version := &devicev1alpha2.EdgeXVersion{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, version); err != nil {
+		return nil, errors.Wrapf(err, "failed to get the EdgeXVersion %s", name)
+	}
+	return version, nil
+}
+
+// versionCatalog returns the catalog of the version from its EdgeXVersion.
+func versionCatalog(ctx context.Context, c client.Reader, name string, security bool) (*devicev1alpha2.VersionCatalog, error) {
+	version, err := edgexVersion(ctx, c, name)
+	if err != nil {
+		return nil, err
+	}
+	return version.Catalog(security), nil
+}
+
+// catalogComponents returns the components of the catalog.
+func catalogComponents(catalog *devicev1alpha2.VersionCatalog) []*Component {
+	components := make([]*Component, 0, len(catalog.Components))
+	for i := range catalog.Components {
+		components = append(components, &catalog.Components[i])
+	}
+	return components
+}
+
+// MergeVersions merges the overlays over the base versions, a version of an overlay
+// replaces the one with the same name and the other versions are appended.
+func MergeVersions(base []*Version, overlays ...[]*Version) []*Version {
+	merged := append([]*Version{}, base...)
+	index := make(map[string]int, len(merged))
+	for i, version := range merged {
+		index[version.Name] = i
+	}
+	for _, overlay := range overlays {
+		for _, version := range overlay {
+			if i, ok := index[version.Name]; ok {
+				merged[i] = version
+				continue
+			}
+			index[version.Name] = len(merged)
+			merged = append(merged, version)
+		}
+	}
+	return merged
+}
+
+// CatalogReconciler publishes the version catalog as EdgeXVersion objects. The catalog embedded in the manager
+// is published at startup, and the catalog configmaps are merged over it each time they change.
+type CatalogReconciler struct {
+	client.Client
+
+	// Namespace where the catalog configmaps live, no configmap is watched when it is empty
+	Namespace string
+
+	// The versions and the manifest embedded in the manager
+	SecurityVersions []*Version
+	NoSectyVersions  []*Version
+	Manifest         []byte
+
+	// Recorder records the events of the invalid catalog configmaps
+	Recorder record.EventRecorder
+
+	// OnReload is called with the manifests of the catalog configmaps after each reload
+	OnReload func(manifests [][]byte) error
+}
+
+func (r *CatalogReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	configmaps := &corev1.ConfigMapList{}
+	if r.Namespace != "" {
+		if err := r.List(ctx, configmaps, client.InNamespace(r.Namespace), client.HasLabels{LabelEdgeXCatalog}); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	// Merge in a stable order, so the configmap named last wins when several define the same version
+	sort.Slice(configmaps.Items, func(i, j int) bool {
+		return configmaps.Items[i].Name < configmaps.Items[j].Name
+	})
+
+	var (
+		securityOverlays [][]*Version
+		nosectyOverlays  [][]*Version
+		manifests        [][]byte
+	)
+	for i := range configmaps.Items {
+		cm := &configmaps.Items[i]
+		// An invalid configmap is skipped, so that it does not hold back the rest of the catalog
+		security, nosecty, err := parseCatalogConfigMap(cm)
+		if err != nil {
+			logger.Error(err, "skipped the invalid catalog configmap", "configmap", client.ObjectKeyFromObject(cm))
+			if r.Recorder != nil {
+				r.Recorder.Eventf(cm, corev1.EventTypeWarning, InvalidCatalogReason, "skipped by the EdgeX catalog: %v", err)
+			}
+			continue
+		}
+		securityOverlays = append(securityOverlays, security)
+		nosectyOverlays = append(nosectyOverlays, nosecty)
+		if manifest, ok := cm.Data[CatalogManifestKey]; ok {
+			manifests = append(manifests, []byte(manifest))
+		}
+	}
+
+	if r.OnReload != nil {
+		if err := r.OnReload(manifests); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	latestVersion, err := latestVersion(append([][]byte{r.Manifest}, manifests...))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.publish(ctx,
+		MergeVersions(r.SecurityVersions, securityOverlays...),
+		MergeVersions(r.NoSectyVersions, nosectyOverlays...),
+		latestVersion); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	logger.Info("published the EdgeX version catalog", "configmaps", len(configmaps.Items), "default", latestVersion)
+	return ctrl.Result{}, nil
+}
+
+// publish creates or updates the EdgeXVersion of each version, and retracts the ones published before
+// which are not in the catalog anymore. The EdgeXVersions without the generate label belong to the users,
+// they are never overwritten so that a patched release can be kept.
+func (r *CatalogReconciler) publish(ctx context.Context, security, nosecty []*Version, defaultVersion string) error {
+	specs := make(map[string]*devicev1alpha2.EdgeXVersionSpec)
+	var names []string
+	spec := func(name string) *devicev1alpha2.EdgeXVersionSpec {
+		if _, ok := specs[name]; !ok {
+			specs[name] = &devicev1alpha2.EdgeXVersionSpec{Default: name == defaultVersion}
+			names = append(names, name)
+		}
+		return specs[name]
+	}
+	for _, version := range security {
+		spec(version.Name).Security = toVersionCatalog(version)
+	}
+	for _, version := range nosecty {
+		spec(version.Name).NoSecty = toVersionCatalog(version)
+	}
+
+	for _, name := range names {
+		version := &devicev1alpha2.EdgeXVersion{}
+		err := r.Get(ctx, types.NamespacedName{Name: name}, version)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		if err == nil && version.Labels[devicev1alpha2.LabelEdgeXGenerate] != LabelCatalog {
+			continue
+		}
+
+		version.Name = name
+		if version.Labels == nil {
+			version.Labels = make(map[string]string)
+		}
+		version.Labels[devicev1alpha2.LabelEdgeXGenerate] = LabelCatalog
+		version.Spec = *specs[name]
+
+		if version.ResourceVersion == "" {
+			err = r.Create(ctx, version)
+		} else {
+			err = r.Update(ctx, version)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to publish the EdgeXVersion %s", name)
+		}
+	}
+	return r.retract(ctx, specs)
+}
+
+// retract deletes the EdgeXVersions published from the catalog which are not in it anymore,
+// unless an edgex still runs them.
+func (r *CatalogReconciler) retract(ctx context.Context, published map[string]*devicev1alpha2.EdgeXVersionSpec) error {
+	versions := &devicev1alpha2.EdgeXVersionList{}
+	if err := r.List(ctx, versions, client.MatchingLabels{devicev1alpha2.LabelEdgeXGenerate: LabelCatalog}); err != nil {
+		return err
+	}
+	edgexes := &devicev1alpha2.EdgeXList{}
+	if err := r.List(ctx, edgexes); err != nil {
+		return err
+	}
+	used := make(map[string]bool)
+	for _, edgex := range edgexes.Items {
+		used[edgex.Spec.Version] = true
+		used[edgex.Status.Version] = true
+	}
+
+	for i := range versions.Items {
+		version := &versions.Items[i]
+		if _, ok := published[version.Name]; ok {
+			continue
+		}
+		if used[version.Name] {
+			log.FromContext(ctx).Info("kept the EdgeXVersion retracted from the catalog, it is still used", "version", version.Name)
+			continue
+		}
+		if err := r.Delete(ctx, version); client.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "failed to retract the EdgeXVersion %s", version.Name)
+		}
+	}
+	return nil
+}
+
+func toVersionCatalog(version *Version) devicev1alpha2.VersionCatalog {
+	catalog := devicev1alpha2.VersionCatalog{ConfigMaps: version.ConfigMaps}
+	for _, component := range version.Components {
+		catalog.Components = append(catalog.Components, *component)
+	}
+	return catalog
+}
+
+// latestVersion returns the latest version of the manifests, the latter ones take precedence.
+func latestVersion(manifests [][]byte) (string, error) {
+	var latest string
+	for _, content := range manifests {
+		manifest := struct {
+			LatestVersion string `yaml:"latestVersion"`
+		}{}
+		if err := yaml.Unmarshal(content, &manifest); err != nil {
+			return "", errors.Wrap(err, "invalid EdgeX manifest")
+		}
+		if manifest.LatestVersion != "" {
+			latest = manifest.LatestVersion
+		}
+	}
+	return latest, nil
+}
+
+// parseCatalogConfigMap parses the versions of the catalog configmap and checks its manifest.
+func parseCatalogConfigMap(cm *corev1.ConfigMap) (security, nosecty []*Version, err error) {
+	if security, err = parseCatalog(cm.Data[CatalogSecurityKey]); err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid %s", CatalogSecurityKey)
+	}
+	if nosecty, err = parseCatalog(cm.Data[CatalogNoSectyKey]); err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid %s", CatalogNoSectyKey)
+	}
+	if manifest, ok := cm.Data[CatalogManifestKey]; ok {
+		if _, err := latestVersion([][]byte{[]byte(manifest)}); err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid %s", CatalogManifestKey)
+		}
+	}
+	return security, nosecty, nil
+}
+
+func parseCatalog(content string) ([]*Version, error) {
+	if content == "" {
+		return nil, nil
+	}
+	config := EdgeXConfig{}
+	if err := json.Unmarshal([]byte(content), &config); err != nil {
+		return nil, err
+	}
+	return config.Versions, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CatalogReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Publish the embedded catalog once the caches are synced, even if there is no catalog configmap,
+	// and retry until it succeeds rather than stopping the manager.
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		_ = wait.PollImmediateUntil(10*time.Second, func() (bool, error) {
+			if _, err := r.Reconcile(ctx, ctrl.Request{}); err != nil {
+				log.FromContext(ctx).Error(err, "failed to publish the EdgeX version catalog")
+				return false, nil
+			}
+			return true, nil
+		}, ctx.Done())
+		return nil
+	})); err != nil {
+		return err
+	}
+	if r.Namespace == "" {
+		return nil
+	}
+
+	isCatalog := func(obj client.Object) bool {
+		_, ok := obj.GetLabels()[LabelEdgeXCatalog]
+		return obj.GetNamespace() == r.Namespace && ok
+	}
+	catalogChanged := predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return isCatalog(e.Object) },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return isCatalog(e.Object) },
+		UpdateFunc:  func(e event.UpdateEvent) bool { return isCatalog(e.ObjectOld) || isCatalog(e.ObjectNew) },
+		GenericFunc: func(e event.GenericEvent) bool { return isCatalog(e.Object) },
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("edgex-catalog").
+		For(&corev1.ConfigMap{}, builder.WithPredicates(catalogChanged)).
+		Complete(r)
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func TestCatalogReconciler(t *testing.T) {
+	embeddedSecurity := []*Version{{Name: "levski", Components: []*Component{{Name: "edgex-vault"}}}}
+	embeddedNoSecty := []*Version{
+		{Name: "levski", Components: []*Component{{Name: "edgex-redis"}}},
+		{Name: "jakarta", Components: []*Component{{Name: "edgex-redis"}}},
+	}
+	// a version created by the user is never overwritten by the catalog
+	patched := &devicev1alpha2.EdgeXVersion{
+		ObjectMeta: metav1.ObjectMeta{Name: "jakarta"},
+		Spec: devicev1alpha2.EdgeXVersionSpec{
+			NoSecty: devicev1alpha2.VersionCatalog{Components: []Component{{Name: "edgex-redis"}, {Name: "edgex-core-data"}}},
+		},
+	}
+
+	catalog := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "edgex-catalog-minnesota",
+			Namespace: "edgex-system",
+			Labels:    map[string]string{LabelEdgeXCatalog: "true"},
+		},
+		Data: map[string]string{
+			CatalogNoSectyKey: `{"versions":[
+				{"versionName":"levski","components":[{"name":"edgex-redis"},{"name":"edgex-core-data"}]},
+				{"versionName":"minnesota","components":[{"name":"edgex-core-keeper"}]}]}`,
+			CatalogManifestKey: "latestVersion: minnesota\n",
+		},
+	}
+	// configmaps without the label or in other namespaces are ignored
+	ignored := catalog.DeepCopy()
+	ignored.Name = "unlabelled"
+	ignored.Labels = nil
+	other := catalog.DeepCopy()
+	other.Namespace = "default"
+
+	var reloadedManifests [][]byte
+	r := &CatalogReconciler{
+		Client:           fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(catalog, ignored, other, patched).Build(),
+		Namespace:        "edgex-system",
+		SecurityVersions: embeddedSecurity,
+		NoSectyVersions:  embeddedNoSecty,
+		Manifest:         []byte("latestVersion: levski\n"),
+		OnReload: func(manifests [][]byte) error {
+			reloadedManifests = manifests
+			return nil
+		},
+	}
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reloadedManifests) != 1 || string(reloadedManifests[0]) != "latestVersion: minnesota\n" {
+		t.Fatalf("unexpected reload with manifests %q", reloadedManifests)
+	}
+	components := func(name string, security bool) int {
+		version := &devicev1alpha2.EdgeXVersion{}
+		if err := r.Get(context.TODO(), types.NamespacedName{Name: name}, version); err != nil {
+			t.Fatal(err)
+		}
+		return len(version.Catalog(security).Components)
+	}
+	if n := components("levski", false); n != 2 {
+		t.Errorf("levski should be replaced by the catalog configmap, got %d components", n)
+	}
+	if n := components("minnesota", false); n != 1 {
+		t.Errorf("minnesota should be added by the catalog configmap, got %d components", n)
+	}
+	if n := components("jakarta", false); n != 2 {
+		t.Errorf("jakarta created by the user should be kept, got %d components", n)
+	}
+	if n := components("levski", true); n != 1 {
+		t.Errorf("security levski should be kept from the embedded catalog, got %d components", n)
+	}
+
+	versions := &devicev1alpha2.EdgeXVersionList{}
+	if err := r.List(context.TODO(), versions); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range versions.Items {
+		if version.Spec.Default != (version.Name == "minnesota") {
+			t.Errorf("only minnesota should be the default version, got %s with default %v", version.Name, version.Spec.Default)
+		}
+	}
+}
+
+func TestCatalogReconcilerSkipAndRetract(t *testing.T) {
+	embedded := []*Version{{Name: "levski", Components: []*Component{{Name: "edgex-redis"}}}}
+	catalog := func(name, content string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "edgex-system", Labels: map[string]string{LabelEdgeXCatalog: "true"}},
+			Data:       map[string]string{CatalogNoSectyKey: content},
+		}
+	}
+	minnesota := catalog("edgex-catalog-minnesota", `{"versions":[{"versionName":"minnesota","components":[{"name":"edgex-core-keeper"}]}]}`)
+	napa := catalog("edgex-catalog-napa", `{"versions":[{"versionName":"napa","components":[{"name":"edgex-core-keeper"}]}]}`)
+	broken := catalog("edgex-catalog-broken", `{"versions":[`)
+	// an edgex still runs napa
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default"},
+		Spec:       devicev1alpha2.EdgeXSpec{Version: "levski"},
+		Status:     devicev1alpha2.EdgeXStatus{Version: "napa"},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &CatalogReconciler{
+		Client:          fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(minnesota, napa, broken, edgex).Build(),
+		Namespace:       "edgex-system",
+		NoSectyVersions: embedded,
+		Manifest:        []byte("latestVersion: levski\n"),
+		Recorder:        recorder,
+	}
+	published := func() []string {
+		versions := &devicev1alpha2.EdgeXVersionList{}
+		if err := r.List(context.TODO(), versions); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, version := range versions.Items {
+			names = append(names, version.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	// the invalid configmap is skipped
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{}); err != nil {
+		t.Fatal(err)
+	}
+	if names := published(); !reflect.DeepEqual(names, []string{"levski", "minnesota", "napa"}) {
+		t.Fatalf("unexpected versions %v", names)
+	}
+	if reasons := recordedReasons(recorder); len(reasons) != 1 || reasons[0] != InvalidCatalogReason {
+		t.Fatalf("expected an %s event, got %v", InvalidCatalogReason, reasons)
+	}
+
+	// the versions of the deleted configmaps are retracted, unless they are still used
+	for _, cm := range []*corev1.ConfigMap{minnesota, napa} {
+		if err := r.Delete(context.TODO(), cm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.Reconcile(context.TODO(), ctrl.Request{}); err != nil {
+		t.Fatal(err)
+	}
+	if names := published(); !reflect.DeepEqual(names, []string{"levski", "napa"}) {
+		t.Fatalf("expected minnesota to be retracted, got %v", names)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// categoryConditions lists the condition of each category in the order they are summarized,
+// so that the Ready condition of the edgex reports the lowest category which is not ready
+var categoryConditions = []struct {
+	category  devicev1alpha2.ComponentCategory
+	condition clusterv1.ConditionType
+}{
+	{devicev1alpha2.CategoryInfrastructure, devicev1alpha2.InfrastructureReadyCondition},
+	{devicev1alpha2.CategorySecurity, devicev1alpha2.SecurityServicesReadyCondition},
+	{devicev1alpha2.CategoryCore, devicev1alpha2.CoreServicesReadyCondition},
+	{devicev1alpha2.CategoryDevice, devicev1alpha2.DeviceServicesReadyCondition},
+	{devicev1alpha2.CategoryApp, devicev1alpha2.AppServicesReadyCondition},
+}
+
+// summaryConditions are the conditions the Ready condition of the edgex is summarized from.
+func summaryConditions() []clusterv1.ConditionType {
+	types := []clusterv1.ConditionType{devicev1alpha2.ConfigmapAvailableCondition}
+	for _, c := range categoryConditions {
+		types = append(types, c.condition)
+	}
+	return append(types, devicev1alpha2.ComponentAvailableCondition, devicev1alpha2.EdgeXAPIHealthyCondition)
+}
+
+// markCategories sets the condition of each category from the status of its components,
+// the condition of a category without any component is removed.
+func markCategories(edgex *devicev1alpha2.EdgeX, components []*Component, status []devicev1alpha2.ComponentStatus) {
+	present := make(map[devicev1alpha2.ComponentCategory]bool)
+	unready := make(map[devicev1alpha2.ComponentCategory][]string)
+	for i, component := range components {
+		category := component.ResolvedCategory()
+		present[category] = true
+		if !status[i].Ready {
+			unready[category] = append(unready[category], component.Name)
+		}
+	}
+
+	for _, c := range categoryConditions {
+		switch {
+		case !present[c.category]:
+			conditions.Delete(edgex, c.condition)
+		case len(unready[c.category]) > 0:
+			conditions.MarkFalse(edgex, c.condition, devicev1alpha2.ComponentsNotReadyReason, clusterv1.ConditionSeverityInfo,
+				"%s not ready: %s", c.category, strings.Join(unready[c.category], ","))
+		default:
+			conditions.MarkTrue(edgex, c.condition)
+		}
+	}
+}
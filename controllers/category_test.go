@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func TestComponentCategory(t *testing.T) {
+	cases := map[string]devicev1alpha2.ComponentCategory{
+		"edgex-core-consul":                devicev1alpha2.CategoryInfrastructure,
+		"edgex-redis":                      devicev1alpha2.CategoryInfrastructure,
+		"edgex-security-secretstore-setup": devicev1alpha2.CategorySecurity,
+		"edgex-kong-db":                    devicev1alpha2.CategorySecurity,
+		"edgex-core-metadata":              devicev1alpha2.CategoryCore,
+		"edgex-sys-mgmt-agent":             devicev1alpha2.CategoryCore,
+		"edgex-device-virtual":             devicev1alpha2.CategoryDevice,
+		"edgex-kuiper":                     devicev1alpha2.CategoryApp,
+		"edgex-ui-go":                      devicev1alpha2.CategoryApp,
+	}
+	for name, expected := range cases {
+		if category := (&Component{Name: name}).ResolvedCategory(); category != expected {
+			t.Errorf("expected %s in %s, got %s", name, expected, category)
+		}
+	}
+
+	// the category of the catalog wins over the name
+	if category := (&Component{Name: "edgex-redis", Category: devicev1alpha2.CategoryApp}).ResolvedCategory(); category != devicev1alpha2.CategoryApp {
+		t.Errorf("expected the category of the catalog, got %s", category)
+	}
+}
+
+func TestMarkCategories(t *testing.T) {
+	edgex := &devicev1alpha2.EdgeX{}
+	conditions.MarkTrue(edgex, devicev1alpha2.AppServicesReadyCondition)
+	components := []*Component{
+		{Name: "edgex-redis"},
+		{Name: "edgex-core-metadata"},
+		{Name: "edgex-core-data"},
+		{Name: "edgex-device-virtual"},
+	}
+	status := []devicev1alpha2.ComponentStatus{
+		{Name: "edgex-redis", Ready: true},
+		{Name: "edgex-core-metadata"},
+		{Name: "edgex-core-data"},
+		{Name: "edgex-device-virtual"},
+	}
+	markCategories(edgex, components, status)
+
+	if !conditions.IsTrue(edgex, devicev1alpha2.InfrastructureReadyCondition) {
+		t.Error("the infrastructure should be ready")
+	}
+	if !conditions.IsFalse(edgex, devicev1alpha2.CoreServicesReadyCondition) {
+		t.Fatal("the core services should not be ready")
+	}
+	if msg := conditions.GetMessage(edgex, devicev1alpha2.CoreServicesReadyCondition); msg != "Core not ready: edgex-core-metadata,edgex-core-data" {
+		t.Errorf("unexpected message %q", msg)
+	}
+	// the categories without any component are not summarized
+	if conditions.Has(edgex, devicev1alpha2.AppServicesReadyCondition) || conditions.Has(edgex, devicev1alpha2.SecurityServicesReadyCondition) {
+		t.Error("the conditions of the categories without components should be removed")
+	}
+
+	// Ready reports the lowest category which is not ready
+	conditions.MarkTrue(edgex, devicev1alpha2.ConfigmapAvailableCondition)
+	conditions.MarkFalse(edgex, devicev1alpha2.ComponentAvailableCondition, devicev1alpha2.ComponentProvisioningReason, clusterv1.ConditionSeverityInfo, "")
+	conditions.SetSummary(edgex, conditions.WithConditions(summaryConditions()...))
+	if reason := conditions.GetReason(edgex, clusterv1.ReadyCondition); reason != devicev1alpha2.ComponentsNotReadyReason {
+		t.Errorf("expected Ready to be %s, got %s", devicev1alpha2.ComponentsNotReadyReason, reason)
+	}
+	if msg := conditions.GetMessage(edgex, clusterv1.ReadyCondition); msg != "Core not ready: edgex-core-metadata,edgex-core-data" {
+		t.Errorf("expected Ready to explain the core services, got %q", msg)
+	}
+}
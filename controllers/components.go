@@ -0,0 +1,57 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// desiredComponents returns the components that should be deployed for the edgex.
+// The components of the catalog are all deployed except the ones disabled in edgex.Spec.Components.
+// The additional components carried in the annotations are always appended.
+func desiredComponents(edgex *devicev1alpha2.EdgeX, catalog *devicev1alpha2.VersionCatalog) ([]*Component, error) {
+	components := filterComponents(edgex, catalogComponents(catalog))
+
+	additionalComponents, err := annotationToComponent(edgex.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	return append(components, additionalComponents...), nil
+}
+
+// filterComponents keeps the components of the catalog deployed for the edgex.
+func filterComponents(edgex *devicev1alpha2.EdgeX, components []*Component) []*Component {
+	filtered := make([]*Component, 0, len(components))
+	for _, c := range components {
+		if edgex.Deploys(c.Name) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+// removePool removes the pool from the yurtappset topology and reports whether it was found.
+func removePool(ud *unitv1alpha1.YurtAppSet, poolName string) bool {
+	i := findPool(ud, poolName)
+	if i < 0 {
+		return false
+	}
+	ud.Spec.Topology.Pools = append(ud.Spec.Topology.Pools[:i], ud.Spec.Topology.Pools[i+1:]...)
+	return true
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
+	"k8s.io/utils/pointer"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func TestFilterComponents(t *testing.T) {
+	components := []*Component{
+		{Name: "edgex-redis"},
+		{Name: "edgex-core-data"},
+		{Name: "edgex-ui-go"},
+	}
+
+	edgex := &devicev1alpha2.EdgeX{}
+	if got := filterComponents(edgex, components); len(got) != len(components) {
+		t.Fatalf("expected all %d components without entries, got %d", len(components), len(got))
+	}
+
+	// the entries only naming or overriding a component keep the others deployed
+	edgex.Spec.Components = []devicev1alpha2.Component{
+		{Name: "edgex-core-data", Image: "myrepo/core-data:2.3.1-patched"},
+		{Name: "edgex-redis"},
+		{Name: "edgex-unknown"},
+	}
+	if got := filterComponents(edgex, components); len(got) != len(components) {
+		t.Fatalf("expected all %d components with the overrides, got %v", len(components), got)
+	}
+
+	// the disabled components are left out, even with an override
+	edgex.Spec.Components = append(edgex.Spec.Components,
+		devicev1alpha2.Component{Name: "edgex-ui-go", Enabled: pointer.BoolPtr(false), Image: "myrepo/ui-go:2.3.0"})
+	edgex.Spec.Components[1].Enabled = pointer.BoolPtr(true)
+	got := filterComponents(edgex, components)
+	if len(got) != 2 || got[0].Name != "edgex-redis" || got[1].Name != "edgex-core-data" {
+		t.Fatalf("unexpected filtered components %v", got)
+	}
+}
+
+func TestDesiredComponents(t *testing.T) {
+	version := &devicev1alpha2.EdgeXVersion{
+		Spec: devicev1alpha2.EdgeXVersionSpec{
+			Security: devicev1alpha2.VersionCatalog{Components: []Component{{Name: "edgex-vault"}, {Name: "edgex-redis"}}},
+			NoSecty:  devicev1alpha2.VersionCatalog{Components: []Component{{Name: "edgex-redis"}, {Name: "edgex-ui-go"}}},
+		},
+	}
+
+	edgex := &devicev1alpha2.EdgeX{
+		Spec: devicev1alpha2.EdgeXSpec{
+			Version:    "testing",
+			Components: []devicev1alpha2.Component{{Name: "edgex-ui-go", Enabled: pointer.BoolPtr(false)}},
+		},
+	}
+	edgex.Annotations = map[string]string{
+		"AdditionalServices": `[{"metadata":{"name":"edgex-device-virtual"},"spec":{}}]`,
+	}
+
+	components, err := desiredComponents(edgex, version.Catalog(edgex.Spec.Security))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(components) != 2 || components[0].Name != "edgex-redis" || components[1].Name != "edgex-device-virtual" {
+		t.Fatalf("unexpected desired components %v", components)
+	}
+
+	edgex.Spec.Security = true
+	edgex.Spec.Components = nil
+	edgex.Annotations = nil
+	components, err = desiredComponents(edgex, version.Catalog(edgex.Spec.Security))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(components) != 2 || components[0].Name != "edgex-vault" {
+		t.Fatalf("unexpected desired security components %v", components)
+	}
+}
+
+func TestRemovePool(t *testing.T) {
+	ud := &unitv1alpha1.YurtAppSet{}
+	ud.Spec.Topology.Pools = []unitv1alpha1.Pool{{Name: "beijing"}, {Name: "hangzhou"}, {Name: "shanghai"}}
+
+	if removePool(ud, "shenzhen") {
+		t.Fatal("should not remove a pool which does not exist")
+	}
+	if !removePool(ud, "hangzhou") {
+		t.Fatal("should remove the hangzhou pool")
+	}
+	if len(ud.Spec.Topology.Pools) != 2 || ud.Spec.Topology.Pools[0].Name != "beijing" || ud.Spec.Topology.Pools[1].Name != "shanghai" {
+		t.Fatalf("unexpected pools %v", ud.Spec.Topology.Pools)
+	}
+}
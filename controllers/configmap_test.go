@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func TestReconcileConfigmap(t *testing.T) {
+	catalog := &devicev1alpha2.VersionCatalog{
+		ConfigMaps: []corev1.ConfigMap{{
+			ObjectMeta: metav1.ObjectMeta{Name: "common-variable-levski"},
+			Data:       map[string]string{"EDGEX_SECURITY_SECRET_STORE": "false"},
+		}},
+	}
+	beijing := &devicev1alpha2.EdgeX{ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default", UID: "beijing"}}
+	hangzhou := &devicev1alpha2.EdgeX{ObjectMeta: metav1.ObjectMeta{Name: "edgex-hangzhou", Namespace: "default", UID: "hangzhou"}}
+
+	// the configmap shared by the edgexes before
+	shared := catalog.ConfigMaps[0].DeepCopy()
+	shared.Namespace = "default"
+	shared.Labels = map[string]string{devicev1alpha2.LabelEdgeXGenerate: LabelConfigmap}
+	shared.OwnerReferences = []metav1.OwnerReference{{APIVersion: "device.openyurt.io/v1alpha2", Kind: "EdgeX", Name: "edgex-beijing", UID: "beijing"}}
+
+	scheme := newTestScheme()
+	r := &EdgeXReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(shared).Build(),
+		Scheme: scheme,
+	}
+	for _, edgex := range []*devicev1alpha2.EdgeX{beijing, hangzhou} {
+		if _, err := r.reconcileConfigmap(context.TODO(), edgex, catalog, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the variables of a pool can be overridden without affecting the other pools
+	beijing.Spec.Env = []corev1.EnvVar{{Name: "STAGEGATE_WAITFOR_TIMEOUT", Value: "120s"}}
+	if _, err := r.reconcileConfigmap(context.TODO(), beijing, catalog, nil); err != nil {
+		t.Fatal(err)
+	}
+	configmap := &corev1.ConfigMap{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "edgex-beijing-common-variable-levski"}, configmap); err != nil {
+		t.Fatal(err)
+	}
+	if configmap.Data["STAGEGATE_WAITFOR_TIMEOUT"] != "120s" || configmap.Data["EDGEX_SECURITY_SECRET_STORE"] != "false" {
+		t.Fatalf("the env should be merged over the catalog, got %v", configmap.Data)
+	}
+	if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "edgex-hangzhou-common-variable-levski"}, configmap); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := configmap.Data["STAGEGATE_WAITFOR_TIMEOUT"]; ok {
+		t.Fatal("the configmap of the other edgex should not be changed")
+	}
+
+	if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "common-variable-levski"}, configmap); !apierrors.IsNotFound(err) {
+		t.Fatalf("the shared configmap should be released, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func TestReconcileDelete(t *testing.T) {
+	beijing := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default", UID: "beijing", Finalizers: []string{devicev1alpha2.EdgexFinalizer}},
+		Spec:       devicev1alpha2.EdgeXSpec{PoolName: "beijing"},
+	}
+	hangzhou := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-hangzhou", Namespace: "default", UID: "hangzhou"},
+		Spec:       devicev1alpha2.EdgeXSpec{PoolName: "hangzhou"},
+	}
+	owners := func(edgexes ...*devicev1alpha2.EdgeX) []metav1.OwnerReference {
+		var refs []metav1.OwnerReference
+		for _, edgex := range edgexes {
+			refs = append(refs, metav1.OwnerReference{APIVersion: devicev1alpha2.GroupVersion.String(), Kind: "EdgeX", Name: edgex.Name, UID: edgex.UID})
+		}
+		return refs
+	}
+	yurtAppSet := func(name string, pools ...string) *unitv1alpha1.YurtAppSet {
+		ud := &unitv1alpha1.YurtAppSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       "default",
+				Labels:          map[string]string{devicev1alpha2.LabelEdgeXGenerate: LabelDeployment},
+				OwnerReferences: owners(beijing),
+			},
+			Spec: unitv1alpha1.YurtAppSetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}}},
+		}
+		for _, pool := range pools {
+			ud.Spec.Topology.Pools = append(ud.Spec.Topology.Pools, unitv1alpha1.Pool{Name: pool})
+		}
+		return ud
+	}
+
+	redis := yurtAppSet("edgex-redis", "beijing")
+	coreData := yurtAppSet("edgex-core-data", "beijing", "hangzhou")
+	coreData.OwnerReferences = owners(beijing, hangzhou)
+	sharedService := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name: "edgex-core-data", Namespace: "default", OwnerReferences: owners(beijing, hangzhou),
+		Labels: map[string]string{devicev1alpha2.LabelEdgeXGenerate: LabelService},
+	}}
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name: "edgex-redis", Namespace: "default", OwnerReferences: owners(beijing),
+		Labels: map[string]string{devicev1alpha2.LabelEdgeXGenerate: LabelService},
+	}}
+	configmap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name: "edgex-beijing-common-variables", Namespace: "default", OwnerReferences: owners(beijing),
+		Labels: map[string]string{devicev1alpha2.LabelEdgeXGenerate: LabelConfigmap},
+	}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name: "edgex-redis-beijing-xxx", Namespace: "default",
+		Labels: map[string]string{"app": "edgex-redis", unitv1alpha1.PoolNameLabelKey: "beijing"},
+	}}
+
+	scheme := newTestScheme()
+	r := &EdgeXReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(redis, coreData, sharedService, service, configmap, pod).Build(),
+		Scheme: scheme,
+	}
+
+	// the resources are kept until the pods in the pool are gone
+	result, err := r.reconcileDelete(context.TODO(), beijing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter == 0 || !controllerutil.ContainsFinalizer(beijing, devicev1alpha2.EdgexFinalizer) {
+		t.Fatal("the deletion should wait for the pods")
+	}
+	if conditions.GetReason(beijing, devicev1alpha2.DeletingCondition) != devicev1alpha2.WaitingForPodsDeletionReason {
+		t.Fatalf("unexpected deleting condition %v", conditions.Get(beijing, devicev1alpha2.DeletingCondition))
+	}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(redis), &unitv1alpha1.YurtAppSet{}); !apierrors.IsNotFound(err) {
+		t.Fatal("the yurtappset without pools should be deleted", err)
+	}
+	ud := &unitv1alpha1.YurtAppSet{}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(coreData), ud); err != nil {
+		t.Fatal(err)
+	}
+	if len(ud.Spec.Topology.Pools) != 1 || len(ud.OwnerReferences) != 1 || ud.OwnerReferences[0].UID != hangzhou.UID {
+		t.Fatalf("the pool and the owner of beijing should be removed, got %v %v", ud.Spec.Topology.Pools, ud.OwnerReferences)
+	}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(configmap), &corev1.ConfigMap{}); err != nil {
+		t.Fatal("the configmap should be kept while the pods are running", err)
+	}
+
+	if err := r.Delete(context.TODO(), pod); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.reconcileDelete(context.TODO(), beijing); err != nil {
+		t.Fatal(err)
+	}
+	if controllerutil.ContainsFinalizer(beijing, devicev1alpha2.EdgexFinalizer) {
+		t.Fatal("the finalizer should be removed")
+	}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(service), &corev1.Service{}); !apierrors.IsNotFound(err) {
+		t.Fatal("the service only owned by beijing should be deleted", err)
+	}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(configmap), &corev1.ConfigMap{}); !apierrors.IsNotFound(err) {
+		t.Fatal("the configmap should be deleted", err)
+	}
+	shared := &corev1.Service{}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(sharedService), shared); err != nil {
+		t.Fatal(err)
+	}
+	if len(shared.OwnerReferences) != 1 || shared.OwnerReferences[0].UID != hangzhou.UID {
+		t.Fatalf("only the owner of beijing should be removed, got %v", shared.OwnerReferences)
+	}
+}
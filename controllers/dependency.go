@@ -0,0 +1,76 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// dependencyWaves returns the wave of each component, a component is in the wave after the last of
+// its dependencies. The dependencies which are not deployed are ignored.
+func dependencyWaves(components []*Component) (map[string]int, error) {
+	deployed := make(map[string]*Component, len(components))
+	for _, component := range components {
+		deployed[component.Name] = component
+	}
+
+	waves := make(map[string]int, len(components))
+	visiting := make(map[string]struct{})
+	var visit func(name string) (int, error)
+	visit = func(name string) (int, error) {
+		if wave, ok := waves[name]; ok {
+			return wave, nil
+		}
+		if _, ok := visiting[name]; ok {
+			return 0, errors.Errorf("the dependencies of component %s are circular", name)
+		}
+		visiting[name] = struct{}{}
+		defer delete(visiting, name)
+
+		wave := 0
+		for _, dependency := range deployed[name].DependsOn {
+			if _, ok := deployed[dependency]; !ok {
+				continue
+			}
+			dependencyWave, err := visit(dependency)
+			if err != nil {
+				return 0, err
+			}
+			if dependencyWave >= wave {
+				wave = dependencyWave + 1
+			}
+		}
+		waves[name] = wave
+		return wave, nil
+	}
+
+	for _, component := range components {
+		if _, err := visit(component.Name); err != nil {
+			return nil, err
+		}
+	}
+	return waves, nil
+}
+
+// sortByWave sorts the components by their dependency wave, the order within a wave is kept.
+func sortByWave(components []*Component, waves map[string]int) {
+	sort.SliceStable(components, func(i, j int) bool {
+		return waves[components[i].Name] < waves[components[j].Name]
+	})
+}
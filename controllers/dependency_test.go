@@ -0,0 +1,101 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func TestDependencyWaves(t *testing.T) {
+	components := []*Component{
+		{Name: "edgex-core-data", DependsOn: []string{"edgex-core-metadata", "edgex-redis"}},
+		{Name: "edgex-core-metadata", DependsOn: []string{"edgex-redis", "edgex-core-consul"}},
+		{Name: "edgex-redis", DependsOn: []string{"edgex-security-bootstrapper"}},
+		{Name: "edgex-ui-go"},
+	}
+	waves, err := dependencyWaves(components)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the dependencies which are not deployed are ignored
+	expected := map[string]int{"edgex-redis": 0, "edgex-ui-go": 0, "edgex-core-metadata": 1, "edgex-core-data": 2}
+	for name, wave := range expected {
+		if waves[name] != wave {
+			t.Errorf("expected %s in wave %d, got %d", name, wave, waves[name])
+		}
+	}
+
+	sortByWave(components, waves)
+	order := []string{"edgex-redis", "edgex-ui-go", "edgex-core-metadata", "edgex-core-data"}
+	for i, name := range order {
+		if components[i].Name != name {
+			t.Fatalf("expected %s at %d, got %s", name, i, components[i].Name)
+		}
+	}
+
+	components[0].DependsOn = []string{"edgex-core-data"}
+	if _, err := dependencyWaves(components); err == nil {
+		t.Fatal("the circular dependencies should be rejected")
+	}
+}
+
+func TestReconcileComponentWaves(t *testing.T) {
+	coreData := testComponent("edgex-core-data", "openyurt/core-data:2.1.0")
+	coreData.DependsOn = []string{"edgex-redis"}
+	catalog := &devicev1alpha2.VersionCatalog{Components: []Component{*coreData, *testComponent("edgex-redis", "openyurt/redis:6.2")}}
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default", UID: "beijing"},
+		Spec:       devicev1alpha2.EdgeXSpec{PoolName: "beijing"},
+	}
+	scheme := newTestScheme()
+	r := &EdgeXReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme}
+
+	if _, err := r.reconcileComponent(context.TODO(), edgex, catalog, "", false); err != nil {
+		t.Fatal(err)
+	}
+	redis := &unitv1alpha1.YurtAppSet{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "edgex-redis"}, redis); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "edgex-core-data"}, &unitv1alpha1.YurtAppSet{}); !apierrors.IsNotFound(err) {
+		t.Fatal("edgex-core-data should wait for edgex-redis", err)
+	}
+
+	// edgex-core-data is created once edgex-redis is ready in the pool
+	redis.Status.PoolReplicas = map[string]int32{"beijing": 1}
+	if err := r.Update(context.TODO(), redis); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Create(context.TODO(), poolDeploymentFor(redis, "beijing", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.reconcileComponent(context.TODO(), edgex, catalog, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "edgex-core-data"}, &unitv1alpha1.YurtAppSet{}); err != nil {
+		t.Fatal("edgex-core-data should be created", err)
+	}
+}
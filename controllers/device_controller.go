@@ -0,0 +1,90 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// DeviceReconciler syncs the devices to core-metadata and mirrors back their state
+type DeviceReconciler struct {
+	MetadataSync
+}
+
+//+kubebuilder:rbac:groups=device.openyurt.io,resources=devices,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=device.openyurt.io,resources=devices/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=device.openyurt.io,resources=devices/finalizers,verbs=update
+
+func (r *DeviceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	device := &devicev1alpha2.Device{}
+	if err := r.Get(ctx, req.NamespacedName, device); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	return r.reconcileInventory(ctx, device,
+		func(metadata *metadataClient) error { return syncDevice(ctx, metadata, device) },
+		func(metadata *metadataClient) error { return metadata.DeleteDevice(ctx, device.Name) },
+	)
+}
+
+// syncDevice adds the device to core-metadata or updates it when it differs. The admin state is owned
+// by the spec like the other properties, while the operating state belongs to the device service.
+// Both are mirrored from core-metadata in the status of the device.
+func syncDevice(ctx context.Context, metadata *metadataClient, device *devicev1alpha2.Device) error {
+	desired := &deviceDTO{Name: device.Name, OperatingState: devicev1alpha2.Up, DeviceProperties: device.Spec.DeviceProperties}
+	if desired.AdminState == "" {
+		desired.AdminState = devicev1alpha2.Unlocked
+	}
+	current, err := metadata.GetDevice(ctx, device.Name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case current == nil:
+		if desired.ID, err = metadata.AddDevice(ctx, desired); err != nil {
+			return err
+		}
+		current = desired
+	case !apiequality.Semantic.DeepEqual(current.DeviceProperties, desired.DeviceProperties):
+		if err := metadata.UpdateDevice(ctx, desired); err != nil {
+			return err
+		}
+		current.DeviceProperties = desired.DeviceProperties
+	}
+	device.Status.EdgeXID = current.ID
+	device.Status.AdminState = current.AdminState
+	device.Status.OperatingState = current.OperatingState
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DeviceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&devicev1alpha2.Device{}).
+		Watches(
+			&source.Kind{Type: &devicev1alpha2.EdgeX{}},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForEdgeX(func() client.ObjectList { return &devicev1alpha2.DeviceList{} })),
+		).
+		Complete(r)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// DeviceProfileReconciler syncs the device profiles to core-metadata
+type DeviceProfileReconciler struct {
+	MetadataSync
+}
+
+//+kubebuilder:rbac:groups=device.openyurt.io,resources=deviceprofiles,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=device.openyurt.io,resources=deviceprofiles/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=device.openyurt.io,resources=deviceprofiles/finalizers,verbs=update
+
+func (r *DeviceProfileReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	profile := &devicev1alpha2.DeviceProfile{}
+	if err := r.Get(ctx, req.NamespacedName, profile); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	return r.reconcileInventory(ctx, profile,
+		func(metadata *metadataClient) error { return syncDeviceProfile(ctx, metadata, profile) },
+		func(metadata *metadataClient) error { return metadata.DeleteDeviceProfile(ctx, profile.Name) },
+	)
+}
+
+// syncDeviceProfile adds the device profile to core-metadata or replaces it when it differs.
+func syncDeviceProfile(ctx context.Context, metadata *metadataClient, profile *devicev1alpha2.DeviceProfile) error {
+	desired := &deviceProfileDTO{Name: profile.Name, DeviceProfileProperties: profile.Spec.DeviceProfileProperties}
+	current, err := metadata.GetDeviceProfile(ctx, profile.Name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case current == nil:
+		if desired.ID, err = metadata.AddDeviceProfile(ctx, desired); err != nil {
+			return err
+		}
+		current = desired
+	case !apiequality.Semantic.DeepEqual(current.DeviceProfileProperties, desired.DeviceProfileProperties):
+		desired.ID = current.ID
+		if err := metadata.UpdateDeviceProfile(ctx, desired); err != nil {
+			return err
+		}
+	}
+	profile.Status.EdgeXID = current.ID
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DeviceProfileReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&devicev1alpha2.DeviceProfile{}).
+		Watches(
+			&source.Kind{Type: &devicev1alpha2.EdgeX{}},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForEdgeX(func() client.ObjectList { return &devicev1alpha2.DeviceProfileList{} })),
+		).
+		Complete(r)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// DeviceServiceReconciler syncs the device services to core-metadata
+type DeviceServiceReconciler struct {
+	MetadataSync
+}
+
+//+kubebuilder:rbac:groups=device.openyurt.io,resources=deviceservices,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=device.openyurt.io,resources=deviceservices/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=device.openyurt.io,resources=deviceservices/finalizers,verbs=update
+
+func (r *DeviceServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	service := &devicev1alpha2.DeviceService{}
+	if err := r.Get(ctx, req.NamespacedName, service); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	return r.reconcileInventory(ctx, service,
+		func(metadata *metadataClient) error { return syncDeviceService(ctx, metadata, service) },
+		func(metadata *metadataClient) error { return metadata.DeleteDeviceService(ctx, service.Name) },
+	)
+}
+
+// syncDeviceService adds the device service to core-metadata or updates it when it differs.
+func syncDeviceService(ctx context.Context, metadata *metadataClient, service *devicev1alpha2.DeviceService) error {
+	desired := &deviceServiceDTO{Name: service.Name, DeviceServiceProperties: service.Spec.DeviceServiceProperties}
+	if desired.AdminState == "" {
+		desired.AdminState = devicev1alpha2.Unlocked
+	}
+	current, err := metadata.GetDeviceService(ctx, service.Name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case current == nil:
+		if desired.ID, err = metadata.AddDeviceService(ctx, desired); err != nil {
+			return err
+		}
+		current = desired
+	case !apiequality.Semantic.DeepEqual(current.DeviceServiceProperties, desired.DeviceServiceProperties):
+		if err := metadata.UpdateDeviceService(ctx, desired); err != nil {
+			return err
+		}
+		current.DeviceServiceProperties = desired.DeviceServiceProperties
+	}
+	service.Status.EdgeXID = current.ID
+	service.Status.AdminState = current.AdminState
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DeviceServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&devicev1alpha2.DeviceService{}).
+		Watches(
+			&source.Kind{Type: &devicev1alpha2.EdgeX{}},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForEdgeX(func() client.ObjectList { return &devicev1alpha2.DeviceServiceList{} })),
+		).
+		Complete(r)
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// markDrift records the components whose yurtappsets drifted from the desired ones,
+// either corrected or kept for the annotation devicev1alpha2.AnnotationIgnoreDrift.
+func markDrift(edgex *devicev1alpha2.EdgeX, corrected, ignored []string) {
+	var messages []string
+	reason := devicev1alpha2.DriftCorrectedReason
+	if len(corrected) > 0 {
+		messages = append(messages, fmt.Sprintf("corrected the drift of %s", strings.Join(corrected, ",")))
+	}
+	if len(ignored) > 0 {
+		messages = append(messages, fmt.Sprintf("kept the hand edits of %s", strings.Join(ignored, ",")))
+		if len(corrected) == 0 {
+			reason = devicev1alpha2.DriftIgnoredReason
+		}
+	}
+
+	if len(messages) == 0 {
+		conditions.MarkFalse(edgex, devicev1alpha2.DriftDetectedCondition, devicev1alpha2.NoDriftReason, clusterv1.ConditionSeverityInfo, "")
+		return
+	}
+	conditions.Set(edgex, &clusterv1.Condition{
+		Type:    devicev1alpha2.DriftDetectedCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: strings.Join(messages, "; "),
+	})
+}
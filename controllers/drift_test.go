@@ -0,0 +1,133 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func TestReconcileComponentDrift(t *testing.T) {
+	catalog := &devicev1alpha2.VersionCatalog{Components: []Component{*testComponent("edgex-core-data", "openyurt/core-data:2.1.0")}}
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default", UID: "beijing", Generation: 1},
+		Spec:       devicev1alpha2.EdgeXSpec{PoolName: "beijing"},
+		Status:     devicev1alpha2.EdgeXStatus{ObservedGeneration: 1},
+	}
+	scheme := newTestScheme()
+	r := &EdgeXReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme}
+	key := types.NamespacedName{Namespace: "default", Name: "edgex-core-data"}
+
+	// handEdit changes the image of the template of the yurtappset
+	handEdit := func(annotations map[string]string) {
+		ud := &unitv1alpha1.YurtAppSet{}
+		if err := r.Get(context.TODO(), key, ud); err != nil {
+			t.Fatal(err)
+		}
+		ud.Annotations = annotations
+		ud.Spec.WorkloadTemplate.DeploymentTemplate.Spec.Template.Spec.Containers[0].Image = "openyurt/core-data:hacked"
+		if err := r.Update(context.TODO(), ud); err != nil {
+			t.Fatal(err)
+		}
+	}
+	templateImage := func() string {
+		ud := &unitv1alpha1.YurtAppSet{}
+		if err := r.Get(context.TODO(), key, ud); err != nil {
+			t.Fatal(err)
+		}
+		return ud.Spec.WorkloadTemplate.DeploymentTemplate.Spec.Template.Spec.Containers[0].Image
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.reconcileComponent(context.TODO(), edgex, catalog, "", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if conditions.IsTrue(edgex, devicev1alpha2.DriftDetectedCondition) {
+		t.Fatal("the yurtappset created by the edgex should not drift")
+	}
+
+	// the defaults filled in by the api server are not a drift
+	ud := &unitv1alpha1.YurtAppSet{}
+	if err := r.Get(context.TODO(), key, ud); err != nil {
+		t.Fatal(err)
+	}
+	podSpec := &ud.Spec.WorkloadTemplate.DeploymentTemplate.Spec.Template.Spec
+	podSpec.DNSPolicy = corev1.DNSClusterFirst
+	podSpec.Containers[0].TerminationMessagePath = corev1.TerminationMessagePathDefault
+	podSpec.Containers[0].ImagePullPolicy = corev1.PullIfNotPresent
+	if err := r.Update(context.TODO(), ud); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.reconcileComponent(context.TODO(), edgex, catalog, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if conditions.IsTrue(edgex, devicev1alpha2.DriftDetectedCondition) {
+		t.Fatal("the defaulted yurtappset should not drift")
+	}
+	defaulted := &unitv1alpha1.YurtAppSet{}
+	if err := r.Get(context.TODO(), key, defaulted); err != nil {
+		t.Fatal(err)
+	}
+	if defaulted.ResourceVersion != ud.ResourceVersion {
+		t.Fatal("the defaulted yurtappset should not be updated")
+	}
+
+	handEdit(nil)
+	if _, err := r.reconcileComponent(context.TODO(), edgex, catalog, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if image := templateImage(); image != "openyurt/core-data:2.1.0" {
+		t.Fatalf("the template should be corrected, got %s", image)
+	}
+	if conditions.GetReason(edgex, devicev1alpha2.DriftDetectedCondition) != devicev1alpha2.DriftCorrectedReason {
+		t.Fatalf("unexpected drift condition %v", conditions.Get(edgex, devicev1alpha2.DriftDetectedCondition))
+	}
+
+	// a new revision of the catalog is rolled out without being taken for a drift
+	catalog.Components[0].Deployment.Template.Spec.Containers[0].Image = "openyurt/core-data:2.1.1"
+	if _, err := r.reconcileComponent(context.TODO(), edgex, catalog, "2", false); err != nil {
+		t.Fatal(err)
+	}
+	if image := templateImage(); image != "openyurt/core-data:2.1.1" {
+		t.Fatalf("the template should follow the catalog, got %s", image)
+	}
+	if conditions.IsTrue(edgex, devicev1alpha2.DriftDetectedCondition) {
+		t.Fatal("the change of the catalog should not be a drift")
+	}
+	edgex.Status.CatalogRevision = "2"
+
+	handEdit(map[string]string{devicev1alpha2.AnnotationIgnoreDrift: "true"})
+	if _, err := r.reconcileComponent(context.TODO(), edgex, catalog, "", false); err != nil {
+		t.Fatal(err)
+	}
+	if image := templateImage(); image != "openyurt/core-data:hacked" {
+		t.Fatalf("the hand edit should be kept, got %s", image)
+	}
+	if conditions.GetReason(edgex, devicev1alpha2.DriftDetectedCondition) != devicev1alpha2.DriftIgnoredReason {
+		t.Fatalf("unexpected drift condition %v", conditions.Get(edgex, devicev1alpha2.DriftDetectedCondition))
+	}
+}
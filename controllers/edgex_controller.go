@@ -19,19 +19,23 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
 	"github.com/pkg/errors"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
-	"k8s.io/utils/pointer"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -41,6 +45,7 @@ import (
 
 	devicev1alpha1 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha1"
 	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+	util "github.com/openyurtio/yurt-edgex-manager/controllers/utils"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/conditions"
@@ -51,6 +56,16 @@ const (
 	LabelConfigmap  = "Configmap"
 	LabelService    = "Service"
 	LabelDeployment = "Deployment"
+	LabelCatalog    = "Catalog"
+
+	LabelPersistentVolumeClaim = "PersistentVolumeClaim"
+	LabelExposedService        = "ExposedService"
+	LabelIngress               = "Ingress"
+
+	// AnnotationEnvChecksum rolls the pods of the pool when edgex.Spec.Env changes
+	AnnotationEnvChecksum = "device.openyurt.io/env-checksum"
+	// AnnotationTemplateHash is the hash of the deployment template last applied to a yurtappset
+	AnnotationTemplateHash = "device.openyurt.io/template-hash"
 
 	AnnotationServiceTopologyKey           = "openyurt.io/topologyKeys"
 	AnnotationServiceTopologyValueNodePool = "openyurt.io/nodepool"
@@ -67,7 +82,15 @@ var (
 // EdgeXReconciler reconciles a EdgeX object
 type EdgeXReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// APIReader reads the deployments and the pods of the pools from the api server, so that they are
+	// not cached by the manager for the whole cluster. The client is used when it is nil.
+	APIReader client.Reader
+
+	// APIChecker probes the REST API of the services of the edgexes with an API health check
+	APIChecker *APIChecker
 }
 
 type EdgeXConfig struct {
@@ -80,27 +103,24 @@ type Version struct {
 	Components []*Component       `yaml:"components,omitempty" json:"components,omitempty"`
 }
 
-type Component struct {
-	Name       string                 `yaml:"name" json:"name"`
-	Service    *corev1.ServiceSpec    `yaml:"service,omitempty" json:"service,omitempty"`
-	Deployment *appsv1.DeploymentSpec `yaml:"deployment,omitempty" json:"deployment,omitempty"`
-}
-
-var (
-	SecurityComponents map[string][]*Component       = make(map[string][]*Component)
-	NoSectyComponents  map[string][]*Component       = make(map[string][]*Component)
-	SecurityConfigMaps map[string][]corev1.ConfigMap = make(map[string][]corev1.ConfigMap)
-	NoSectyConfigMaps  map[string][]corev1.ConfigMap = make(map[string][]corev1.ConfigMap)
-)
+// Component is the catalog entry of a component, the same as the one in EdgeXVersion
+type Component = devicev1alpha2.VersionComponent
 
 //+kubebuilder:rbac:groups=device.openyurt.io,resources=edgexes,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=device.openyurt.io,resources=edgexes/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=device.openyurt.io,resources=edgexes/finalizers,verbs=update
 //+kubebuilder:rbac:groups=device.openyurt.io,resources=edgexes/finalizers,verbs=update
+//+kubebuilder:rbac:groups=device.openyurt.io,resources=edgexversions,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=device.openyurt.io,resources=devices;deviceprofiles;deviceservices,verbs=get;list;watch
 //+kubebuilder:rbac:groups=apps.openyurt.io,resources=yurtappsets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps.openyurt.io,resources=yurtappsets/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=configmaps;services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups=core,resources=configmaps/status;services/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
 
 func (r *EdgeXReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
 	logger := log.FromContext(ctx)
@@ -129,16 +149,19 @@ func (r *EdgeXReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ct
 	defer func() {
 		// always update the readyCondition.
 		conditions.SetSummary(edgex,
-			conditions.WithConditions(
-				devicev1alpha2.ConfigmapAvailableCondition,
-				devicev1alpha2.ComponentAvailableCondition,
-			),
+			conditions.WithConditions(summaryConditions()...),
 		)
 
 		if err := patchHelper.Patch(ctx, edgex); err != nil {
 			reterr = kerrors.NewAggregate([]error{reterr, err})
 		}
 
+		if controllerutil.ContainsFinalizer(edgex, devicev1alpha2.EdgexFinalizer) {
+			recordEdgeXMetrics(edgex)
+		} else {
+			forgetEdgeXMetrics(edgex)
+		}
+
 		if reterr != nil {
 			logger.Error(reterr, "reconcile failed", "edgex", edgex.Namespace+"/"+edgex.Name)
 		}
@@ -154,37 +177,63 @@ func (r *EdgeXReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ct
 }
 
 func (r *EdgeXReconciler) reconcileDelete(ctx context.Context, edgex *devicev1alpha2.EdgeX) (ctrl.Result, error) {
-	ud := &unitv1alpha1.YurtAppSet{}
-	var desiredComponents []*Component
-	if edgex.Spec.Security {
-		desiredComponents = SecurityComponents[edgex.Spec.Version]
-	} else {
-		desiredComponents = NoSectyComponents[edgex.Spec.Version]
+	edgex.Status.Ready = false
+	if r.APIChecker != nil {
+		r.APIChecker.forget(edgex)
 	}
 
-	additionalComponents, err := annotationToComponent(edgex.Annotations)
-	if err != nil {
-		return ctrl.Result{}, err
+	// The workloads of the pool keep running, a new edgex of the pool adopts them
+	if edgex.Spec.DeletionPolicy == devicev1alpha2.DeletionOrphan {
+		r.markDeleting(edgex, devicev1alpha2.OrphaningResourcesReason, "orphaning the resources of pool %s", edgex.Spec.PoolName)
+		if err := r.orphanResources(ctx, edgex); err != nil {
+			return ctrl.Result{}, err
+		}
+		controllerutil.RemoveFinalizer(edgex, devicev1alpha2.EdgexFinalizer)
+		return ctrl.Result{}, nil
 	}
-	desiredComponents = append(desiredComponents, additionalComponents...)
 
-	//TODO: handle edgex.Spec.Components
+	// Walk through every generated yurtappset rather than the desired components,
+	// so that the pools of components dropped from edgex.Spec.Components are released as well.
+	yurtappsetlist := &unitv1alpha1.YurtAppSetList{}
+	if err := r.List(ctx, yurtappsetlist, client.InNamespace(edgex.Namespace), client.MatchingLabels{devicev1alpha2.LabelEdgeXGenerate: LabelDeployment}); err != nil {
+		return ctrl.Result{}, err
+	}
 
-	for _, dc := range desiredComponents {
-		if err := r.Get(
-			ctx,
-			types.NamespacedName{Namespace: edgex.Namespace, Name: dc.Name},
-			ud); err != nil {
-			continue
+	podsRunning := false
+	for i := range yurtappsetlist.Items {
+		ud := &yurtappsetlist.Items[i]
+		if err := r.releaseYurtAppSet(ctx, edgex, ud); err != nil {
+			return ctrl.Result{}, err
 		}
+		running, err := r.poolPodsRunning(ctx, ud, edgex.Spec.PoolName)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		podsRunning = podsRunning || running
+	}
 
-		for i, pool := range ud.Spec.Topology.Pools {
-			if pool.Name == edgex.Spec.PoolName {
-				ud.Spec.Topology.Pools[i] = ud.Spec.Topology.Pools[len(ud.Spec.Topology.Pools)-1]
-				ud.Spec.Topology.Pools = ud.Spec.Topology.Pools[:len(ud.Spec.Topology.Pools)-1]
-			}
+	// The configmaps and the volumes are released only after the pods mounting them are gone
+	if podsRunning {
+		r.markDeleting(edgex, devicev1alpha2.WaitingForPodsDeletionReason, "waiting for the pods in pool %s to be deleted", edgex.Spec.PoolName)
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+	}
+	r.markDeleting(edgex, devicev1alpha2.ReleasingResourcesReason, "releasing the resources of pool %s", edgex.Spec.PoolName)
+
+	if err := r.deleteIngress(ctx, edgex); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.cleanupExposedServices(ctx, edgex, nil); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The shared objects are deleted along with their last owner
+	for _, list := range []client.ObjectList{&corev1.ServiceList{}, &corev1.ConfigMapList{}, &corev1.PersistentVolumeClaimList{}} {
+		if err := r.List(ctx, list, client.InNamespace(edgex.Namespace), client.HasLabels{devicev1alpha2.LabelEdgeXGenerate}); err != nil {
+			return ctrl.Result{}, err
 		}
-		if err := r.Update(ctx, ud); err != nil {
+		if err := meta.EachListItem(list, func(obj runtime.Object) error {
+			return client.IgnoreNotFound(r.removeOwner(ctx, edgex, obj.(client.Object)))
+		}); err != nil {
 			return ctrl.Result{}, err
 		}
 	}
@@ -194,14 +243,88 @@ func (r *EdgeXReconciler) reconcileDelete(ctx context.Context, edgex *devicev1al
 	return ctrl.Result{}, nil
 }
 
+// markDeleting sets the Deleting condition of the edgex, and records an event once the deletion moves on.
+func (r *EdgeXReconciler) markDeleting(edgex *devicev1alpha2.EdgeX, reason, messageFmt string, args ...interface{}) {
+	if conditions.GetReason(edgex, devicev1alpha2.DeletingCondition) != reason {
+		r.eventf(edgex, corev1.EventTypeNormal, reason, messageFmt, args...)
+	}
+	conditions.Set(edgex, &clusterv1.Condition{
+		Type:    devicev1alpha2.DeletingCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: fmt.Sprintf(messageFmt, args...),
+	})
+}
+
+// releaseYurtAppSet removes the pool and the owner reference of the edgex from the yurtappset,
+// the yurtappset is deleted once no pool is left.
+func (r *EdgeXReconciler) releaseYurtAppSet(ctx context.Context, edgex *devicev1alpha2.EdgeX, ud *unitv1alpha1.YurtAppSet) error {
+	if !ud.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	owners := len(ud.GetOwnerReferences())
+	removed := removePool(ud, edgex.Spec.PoolName)
+	removeOwnerReference(edgex, ud)
+	if removed {
+		r.eventf(edgex, corev1.EventTypeNormal, devicev1alpha2.PoolLeftReason, "left pool %s of yurtappset %s", edgex.Spec.PoolName, ud.Name)
+	}
+
+	if len(ud.Spec.Topology.Pools) == 0 {
+		// Wait for the deployments of the yurtappset, so that the pods can be looked up by it
+		return client.IgnoreNotFound(r.Delete(ctx, ud, client.PropagationPolicy(metav1.DeletePropagationForeground)))
+	}
+	if removed || owners != len(ud.GetOwnerReferences()) {
+		return r.Update(ctx, ud)
+	}
+	return nil
+}
+
 func (r *EdgeXReconciler) reconcileNormal(ctx context.Context, edgex *devicev1alpha2.EdgeX) (ctrl.Result, error) {
 	controllerutil.AddFinalizer(edgex, devicev1alpha2.EdgexFinalizer)
 
+	if err := r.adoptOrphans(ctx, edgex); err != nil {
+		return ctrl.Result{}, errors.Wrapf(err,
+			"unexpected error while adopting the orphans for %s", edgex.Namespace+"/"+edgex.Name)
+	}
+
 	edgex.Status.Initialized = true
 
-	if ok, err := r.reconcileConfigmap(ctx, edgex); !ok {
+	previousUpgrade := edgex.Status.Upgrade.DeepCopy()
+	version, fromVersion := planUpgrade(edgex, time.Now())
+	r.recordUpgrade(edgex, previousUpgrade)
+	upgrading := fromVersion != ""
+
+	target, err := edgexVersion(ctx, r.Client, version)
+	if err != nil {
+		conditions.MarkFalse(edgex, devicev1alpha2.ConfigmapAvailableCondition, devicev1alpha2.ConfigmapProvisioningFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		r.eventf(edgex, corev1.EventTypeWarning, devicev1alpha2.ConfigmapProvisioningFailedReason, "%v", err)
+		countProvisioningFailure(edgex, devicev1alpha2.ConfigmapProvisioningFailedReason)
+		return ctrl.Result{}, errors.Wrapf(err,
+			"unexpected error while looking up the version for %s", edgex.Namespace+"/"+edgex.Name)
+	}
+	catalog := target.Catalog(edgex.Spec.Security)
+
+	// The configmaps of the former version are kept until the upgrade completes,
+	// since the components not rolled out yet still mount them.
+	var fromCatalog *devicev1alpha2.VersionCatalog
+	if upgrading {
+		if fromCatalog, err = versionCatalog(ctx, r.Client, fromVersion, edgex.Spec.Security); err != nil {
+			if !apierrors.IsNotFound(errors.Cause(err)) {
+				return ctrl.Result{}, err
+			}
+			fromCatalog = nil
+		}
+	}
+
+	start := time.Now()
+	ok, err := r.reconcileConfigmap(ctx, edgex, catalog, fromCatalog)
+	observePhase(PhaseConfigmap, start)
+	if !ok {
 		if err != nil {
 			conditions.MarkFalse(edgex, devicev1alpha2.ConfigmapAvailableCondition, devicev1alpha2.ConfigmapProvisioningFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+			r.eventf(edgex, corev1.EventTypeWarning, devicev1alpha2.ConfigmapProvisioningFailedReason, "%v", err)
+			countProvisioningFailure(edgex, devicev1alpha2.ConfigmapProvisioningFailedReason)
 			return ctrl.Result{}, errors.Wrapf(err,
 				"unexpected error while reconciling configmap for %s", edgex.Namespace+"/"+edgex.Name)
 		}
@@ -210,9 +333,19 @@ func (r *EdgeXReconciler) reconcileNormal(ctx context.Context, edgex *devicev1al
 	}
 	conditions.MarkTrue(edgex, devicev1alpha2.ConfigmapAvailableCondition)
 
-	if ok, err := r.reconcileComponent(ctx, edgex); !ok {
+	start = time.Now()
+	ok, err = r.reconcileComponent(ctx, edgex, catalog, target.ResourceVersion, upgrading)
+	observePhase(PhaseComponent, start)
+	if err == nil {
+		// The spec and the catalog are applied to all the yurtappsets now, any later change of them is a drift
+		edgex.Status.ObservedGeneration = edgex.Generation
+		edgex.Status.CatalogRevision = target.ResourceVersion
+	}
+	if !ok {
 		if err != nil {
 			conditions.MarkFalse(edgex, devicev1alpha2.ComponentAvailableCondition, devicev1alpha2.ComponentProvisioningFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+			r.eventf(edgex, corev1.EventTypeWarning, devicev1alpha2.ComponentProvisioningFailedReason, "%v", err)
+			countProvisioningFailure(edgex, devicev1alpha2.ComponentProvisioningFailedReason)
 			return ctrl.Result{}, errors.Wrapf(err,
 				"unexpected error while reconciling Component for %s", edgex.Namespace+"/"+edgex.Name)
 		}
@@ -221,7 +354,29 @@ func (r *EdgeXReconciler) reconcileNormal(ctx context.Context, edgex *devicev1al
 	}
 	conditions.MarkTrue(edgex, devicev1alpha2.ComponentAvailableCondition)
 
-	edgex.Status.Ready = true
+	if upgrading {
+		upgrade := edgex.Status.Upgrade
+		completeUpgrade(edgex)
+		if edgex.Status.Upgrade == nil {
+			r.eventf(edgex, corev1.EventTypeNormal, devicev1alpha2.UpgradeSucceededReason,
+				"upgraded from %s to %s", upgrade.FromVersion, upgrade.ToVersion)
+		}
+	}
+
+	// The pods being ready does not mean the services work, e.g. core-metadata cannot reach redis,
+	// so their API is probed when asked for.
+	components, err := desiredComponents(edgex, catalog)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	edgex.Status.Ready = r.checkAPIHealth(edgex, components)
+	if check := edgex.Spec.APIHealthCheck; check != nil {
+		period := DefaultAPIHealthCheckPeriod
+		if check.Period != nil {
+			period = check.Period.Duration
+		}
+		return ctrl.Result{RequeueAfter: period}, nil
+	}
 
 	return ctrl.Result{}, nil
 }
@@ -244,28 +399,42 @@ func (r *EdgeXReconciler) removeOwner(ctx context.Context, edgex *devicev1alpha2
 	return nil
 }
 
-func (r *EdgeXReconciler) reconcileConfigmap(ctx context.Context, edgex *devicev1alpha2.EdgeX) (bool, error) {
-	var configmaps []corev1.ConfigMap
+func (r *EdgeXReconciler) reconcileConfigmap(ctx context.Context, edgex *devicev1alpha2.EdgeX, catalog, fromCatalog *devicev1alpha2.VersionCatalog) (bool, error) {
 	needConfigMaps := make(map[string]struct{})
-
-	if edgex.Spec.Security {
-		configmaps = SecurityConfigMaps[edgex.Spec.Version]
-	} else {
-		configmaps = NoSectyConfigMaps[edgex.Spec.Version]
+	if fromCatalog != nil {
+		for _, configmap := range fromCatalog.ConfigMaps {
+			needConfigMaps[edgexConfigMapName(edgex, configmap.Name)] = struct{}{}
+		}
 	}
-	for _, configmap := range configmaps {
-		// Supplement runtime information
-		configmap.Namespace = edgex.Namespace
-		configmap.Labels = make(map[string]string)
+
+	// Each edgex has its own copy of the catalog configmaps, so the variables can differ
+	// from pool to pool. edgex.Spec.Env is merged over the variables of the catalog.
+	for _, c := range catalog.ConfigMaps {
+		configmap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        edgexConfigMapName(edgex, c.Name),
+				Namespace:   edgex.Namespace,
+				Labels:      make(map[string]string),
+				Annotations: c.Annotations,
+			},
+		}
+		for k, v := range c.Labels {
+			configmap.Labels[k] = v
+		}
 		configmap.Labels[devicev1alpha2.LabelEdgeXGenerate] = LabelConfigmap
 
-		_, err := controllerutil.CreateOrUpdate(ctx, r.Client, &configmap, func() error {
-			return controllerutil.SetOwnerReference(edgex, &configmap, r.Scheme)
+		op, err := controllerutil.CreateOrUpdate(ctx, r.Client, configmap, func() error {
+			configmap.Data = mergeEnv(c.Data, edgex.Spec.Env)
+			configmap.BinaryData = c.BinaryData
+			return controllerutil.SetControllerReference(edgex, configmap, r.Scheme)
 		})
 
 		if err != nil {
 			return false, err
 		}
+		if op == controllerutil.OperationResultCreated {
+			r.eventf(edgex, corev1.EventTypeNormal, devicev1alpha2.ConfigmapProvisionedReason, "created configmap %s", configmap.Name)
+		}
 
 		needConfigMaps[configmap.Name] = struct{}{}
 	}
@@ -282,43 +451,108 @@ func (r *EdgeXReconciler) reconcileConfigmap(ctx context.Context, edgex *devicev
 	return true, nil
 }
 
-func (r *EdgeXReconciler) reconcileComponent(ctx context.Context, edgex *devicev1alpha2.EdgeX) (bool, error) {
-	var desireComponents []*Component
+func (r *EdgeXReconciler) reconcileComponent(ctx context.Context, edgex *devicev1alpha2.EdgeX, catalog *devicev1alpha2.VersionCatalog, revision string, upgrading bool) (bool, error) {
 	needComponents := make(map[string]struct{})
 	var readyComponent int32 = 0
 
-	if edgex.Spec.Security {
-		desireComponents = SecurityComponents[edgex.Spec.Version]
-	} else {
-		desireComponents = NoSectyComponents[edgex.Spec.Version]
+	desireComponents, err := desiredComponents(edgex, catalog)
+	if err != nil {
+		return false, err
 	}
-
-	additionalComponents, err := annotationToComponent(edgex.Annotations)
+	exposedServices := make(map[string]struct{})
+	var driftedComponents, ignoredComponents []string
+	if err := r.reconcilePersistence(ctx, edgex, desireComponents); err != nil {
+		return false, err
+	}
+	waves, err := dependencyWaves(desireComponents)
 	if err != nil {
 		return false, err
 	}
-	desireComponents = append(desireComponents, additionalComponents...)
-
-	//TODO: handle edgex.Spec.Components
+	sortByTier(desireComponents)
+	if !upgrading {
+		sortByWave(desireComponents, waves)
+	}
+	wave := -1
 
 	defer func() {
 		edgex.Status.ReadyComponentNum = readyComponent
 		edgex.Status.UnreadyComponentNum = int32(len(desireComponents)) - readyComponent
 	}()
 
+	componentStatus := make([]devicev1alpha2.ComponentStatus, len(desireComponents))
+
+	// waitForDependencies reports whether a component of an earlier wave is not ready yet,
+	// so that the component is not created before its dependencies are ready in the pool
+	waitForDependencies := func(i int) bool {
+		for j := 0; j < i; j++ {
+			if !componentStatus[j].Ready && waves[desireComponents[j].Name] < waves[desireComponents[i].Name] {
+				return true
+			}
+		}
+		return false
+	}
+
 NextC:
-	for _, desireComponent := range desireComponents {
+	for i, desireComponent := range desireComponents {
 		readyService := false
 		readyDeployment := false
 		needComponents[desireComponent.Name] = struct{}{}
+		status := &componentStatus[i]
+		status.Name = desireComponent.Name
+
+		// An upgrade rolls out the next tier only after all the components before it are ready,
+		// the components of the later tiers keep running the former version until then.
+		if tier := componentTier(desireComponent); upgrading && tier != wave {
+			if readyComponent < int32(i) {
+				for _, c := range desireComponents[i:] {
+					needComponents[c.Name] = struct{}{}
+				}
+				// The components held back keep their former status as they keep running
+				previous := make(map[string]devicev1alpha2.ComponentStatus, len(edgex.Status.Components))
+				for _, status := range edgex.Status.Components {
+					previous[status.Name] = status
+				}
+				for j := i; j < len(desireComponents); j++ {
+					componentStatus[j] = previous[desireComponents[j].Name]
+					componentStatus[j].Name = desireComponents[j].Name
+				}
+				break
+			}
+			wave = tier
+			if edgex.Status.Upgrade.Wave != tierNames[tier] {
+				r.eventf(edgex, corev1.EventTypeNormal, devicev1alpha2.UpgradeWaveStartedReason,
+					"rolling out the %s of %s", tierNames[tier], edgex.Status.Upgrade.ToVersion)
+			}
+			edgex.Status.Upgrade.Wave = tierNames[tier]
+		}
 
-		if _, err := r.handleService(ctx, edgex, desireComponent); err != nil {
-			return false, err
+		service, err := r.handleService(ctx, edgex, desireComponent)
+		if err != nil {
+			return false, componentError(desireComponent, err)
+		}
+		if service != nil {
+			status.ServiceName = service.Name
+			status.ClusterIP = service.Spec.ClusterIP
 		}
 		readyService = true
 
+		exposedService, err := r.handleExposedService(ctx, edgex, desireComponent)
+		if err != nil {
+			return false, componentError(desireComponent, err)
+		}
+		if exposedService != nil {
+			exposedServices[exposedService.Name] = struct{}{}
+		}
+
+		// The additional components carried over from v1alpha1 may only have a service
+		if desireComponent.Deployment == nil {
+			status.Ready = true
+			readyComponent++
+			continue NextC
+		}
+
 		ud := &unitv1alpha1.YurtAppSet{}
-		err := r.Get(
+		err = r.Get(
 			ctx,
 			types.NamespacedName{
 				Namespace: edgex.Namespace,
@@ -326,51 +560,124 @@ NextC:
 			ud)
 		if err != nil {
 			if !apierrors.IsNotFound(err) {
-				return false, err
+				return false, componentError(desireComponent, err)
 			}
-			_, err = r.handleYurtAppSet(ctx, edgex, desireComponent)
+			if waitForDependencies(i) {
+				continue NextC
+			}
+			ud, err = r.handleYurtAppSet(ctx, edgex, catalog, desireComponent)
 			if err != nil {
-				return false, err
+				return false, componentError(desireComponent, err)
 			}
-		} else {
-			if _, ok := ud.Status.PoolReplicas[edgex.Spec.PoolName]; ok {
-				if ud.Status.ReadyReplicas == ud.Status.Replicas {
-					readyDeployment = true
-					if readyDeployment && readyService {
-						readyComponent++
-					}
-				}
-				continue NextC
+			if i := findPool(ud, edgex.Spec.PoolName); i >= 0 {
+				status.Replicas = *ud.Spec.Topology.Pools[i].Replicas
 			}
-			pool := unitv1alpha1.Pool{
-				Name:     edgex.Spec.PoolName,
-				Replicas: pointer.Int32Ptr(1),
+			continue NextC
+		}
+
+		if ud.Spec.WorkloadTemplate.DeploymentTemplate == nil {
+			return false, componentError(desireComponent, errors.Errorf("yurtappset %s/%s has no deployment template", ud.Namespace, ud.Name))
+		}
+		template := &ud.Spec.WorkloadTemplate.DeploymentTemplate.Spec
+		p := findPool(ud, edgex.Spec.PoolName)
+
+		// Migrate the template to the desired one when no other pool shares it, e.g. to the new version,
+		// otherwise the pool patch carries the difference from the template. The patch is made against
+		// the template as applied rather than the live one, which is filled with the defaults.
+		desiredTemplate, baseTemplate := template, template
+		if applied := templateApplied(ud, desireComponent.Deployment); applied || soleOwner(ud, edgex.Spec.PoolName) {
+			baseTemplate = desireComponent.Deployment
+			if !applied {
+				desiredTemplate = desireComponent.Deployment
 			}
-			pool.NodeSelectorTerm.MatchExpressions = append(pool.NodeSelectorTerm.MatchExpressions,
-				corev1.NodeSelectorRequirement{
-					Key:      unitv1alpha1.LabelCurrentNodePool,
-					Operator: corev1.NodeSelectorOpIn,
-					Values:   []string{edgex.Spec.PoolName},
-				})
-			flag := false
-			for _, up := range ud.Spec.Topology.Pools {
-				if up.Name == pool.Name {
-					flag = true
-					break
-				}
+		}
+
+		pool, err := desiredPool(edgex, baseTemplate, renderDeployment(edgex, catalog, desireComponent))
+		if err != nil {
+			return false, componentError(desireComponent, err)
+		}
+		status.Replicas = *pool.Replicas
+
+		inSync := p >= 0 && desiredTemplate == template && poolEqual(ud.Spec.Topology.Pools[p], pool)
+		// The hand edits of the yurtappsets opted out of the drift correction are kept
+		ignoreDrift := p >= 0 && ud.Annotations[devicev1alpha2.AnnotationIgnoreDrift] == "true"
+		if inSync || ignoreDrift {
+			if !inSync {
+				ignoredComponents = append(ignoredComponents, desireComponent.Name)
+			}
+			var deployment *appsv1.Deployment
+			if readyDeployment, deployment, err = r.poolReady(ctx, ud, edgex.Spec.PoolName); err != nil {
+				return false, componentError(desireComponent, err)
 			}
-			if !flag {
-				ud.Spec.Topology.Pools = append(ud.Spec.Topology.Pools, pool)
+			if deployment != nil {
+				status.ReadyReplicas = deployment.Status.ReadyReplicas
+				if container := mainContainer(&deployment.Spec.Template.Spec, desireComponent.Name); container != nil {
+					status.Image = container.Image
+				}
 			}
-			if err := controllerutil.SetOwnerReference(edgex, ud, r.Scheme); err != nil {
-				return false, err
+			if readyDeployment && readyService {
+				status.Ready = true
+				readyComponent++
 			}
-			if err := r.Update(ctx, ud); err != nil {
-				return false, err
+			continue NextC
+		}
+
+		// The components are brought up wave by wave in the pool
+		if p < 0 && waitForDependencies(i) {
+			continue NextC
+		}
+
+		// Neither the edgex nor the catalog of its version changed since they were last applied, so the live yurtappset drifted
+		if p >= 0 && !upgrading && edgex.Status.ObservedGeneration == edgex.Generation && edgex.Status.CatalogRevision == revision {
+			driftedComponents = append(driftedComponents, desireComponent.Name)
+		}
+		if desiredTemplate != template {
+			*template = *desireComponent.Deployment.DeepCopy()
+			if ud.Annotations == nil {
+				ud.Annotations = make(map[string]string)
 			}
+			ud.Annotations[AnnotationTemplateHash] = templateHash(desireComponent.Deployment)
+		}
+		if p >= 0 {
+			// The pool is rendered differently now, e.g. the image is overridden,
+			// update it to roll the deployment of this pool.
+			ud.Spec.Topology.Pools[p] = pool
+		} else {
+			ud.Spec.Topology.Pools = append(ud.Spec.Topology.Pools, pool)
+			r.eventf(edgex, corev1.EventTypeNormal, devicev1alpha2.PoolJoinedReason, "joined pool %s of yurtappset %s", pool.Name, ud.Name)
+		}
+		markGenerated(ud, LabelDeployment)
+		if err := controllerutil.SetOwnerReference(edgex, ud, r.Scheme); err != nil {
+			return false, componentError(desireComponent, err)
+		}
+		if err := r.Update(ctx, ud); err != nil {
+			return false, componentError(desireComponent, err)
 		}
 	}
 
+	r.recordReadiness(edgex, edgex.Status.Components, componentStatus)
+	edgex.Status.Components = updateComponentStatus(edgex.Status.Components, componentStatus)
+	markCategories(edgex, desireComponents, componentStatus)
+	markDrift(edgex, driftedComponents, ignoredComponents)
+	if len(driftedComponents) > 0 {
+		r.eventf(edgex, corev1.EventTypeWarning, devicev1alpha2.DriftCorrectedReason,
+			"corrected the drift of %s", strings.Join(driftedComponents, ","))
+	}
+
+	if err := r.handleIngress(ctx, edgex, desireComponents); err != nil {
+		return false, err
+	}
+
+	// The components dropped by the new version are kept until the upgrade completes,
+	// so that a rollback finds them as they were.
+	if upgrading && readyComponent != int32(len(desireComponents)) {
+		return false, nil
+	}
+
+	if err := r.cleanupExposedServices(ctx, edgex, exposedServices); err != nil {
+		return false, err
+	}
+
 	/* Remove the service owner that we do not need */
 	servicelist := &corev1.ServiceList{}
 	if err := r.List(ctx, servicelist, client.InNamespace(edgex.Namespace), client.MatchingLabels{devicev1alpha2.LabelEdgeXGenerate: LabelService}); err == nil {
@@ -381,11 +688,17 @@ NextC:
 		}
 	}
 
-	/* Remove the yurtappset owner that we do not need */
+	/* Remove the pool and the yurtappset owner that we do not need */
 	yurtappsetlist := &unitv1alpha1.YurtAppSetList{}
 	if err := r.List(ctx, yurtappsetlist, client.InNamespace(edgex.Namespace), client.MatchingLabels{devicev1alpha2.LabelEdgeXGenerate: LabelDeployment}); err == nil {
 		for _, s := range yurtappsetlist.Items {
 			if _, ok := needComponents[s.Name]; !ok {
+				if removePool(&s, edgex.Spec.PoolName) {
+					if err := r.Update(ctx, &s); err != nil {
+						return false, err
+					}
+					r.eventf(edgex, corev1.EventTypeNormal, devicev1alpha2.PoolLeftReason, "left pool %s of yurtappset %s", edgex.Spec.PoolName, s.Name)
+				}
 				r.removeOwner(ctx, edgex, &s)
 			}
 		}
@@ -394,6 +707,12 @@ NextC:
 	return readyComponent == int32(len(desireComponents)), nil
 }
 
+// componentError wraps the error met while provisioning the component, so that the
+// ComponentProvisioningFailed condition tells which component and tier it comes from.
+func componentError(component *Component, err error) error {
+	return errors.Wrapf(err, "failed to provision %s of the %s tier", component.Name, tierNames[componentTier(component)])
+}
+
 func (r *EdgeXReconciler) handleService(ctx context.Context, edgex *devicev1alpha2.EdgeX, component *Component) (*corev1.Service, error) {
 	// It is possible that the component does not need service.
 	// Therefore, you need to be careful when calling this function.
@@ -414,11 +733,12 @@ func (r *EdgeXReconciler) handleService(ctx context.Context, edgex *devicev1alph
 	service.Labels[devicev1alpha2.LabelEdgeXGenerate] = LabelService
 	service.Annotations[AnnotationServiceTopologyKey] = AnnotationServiceTopologyValueNodePool
 
-	_, err := controllerutil.CreateOrUpdate(
+	op, err := controllerutil.CreateOrUpdate(
 		ctx,
 		r.Client,
 		service,
 		func() error {
+			markGenerated(service, LabelService)
 			return controllerutil.SetOwnerReference(edgex, service, r.Scheme)
 		},
 	)
@@ -426,10 +746,13 @@ func (r *EdgeXReconciler) handleService(ctx context.Context, edgex *devicev1alph
 	if err != nil {
 		return nil, err
 	}
+	if op == controllerutil.OperationResultCreated {
+		r.eventf(edgex, corev1.EventTypeNormal, devicev1alpha2.ServiceCreatedReason, "created service %s", service.Name)
+	}
 	return service, nil
 }
 
-func (r *EdgeXReconciler) handleYurtAppSet(ctx context.Context, edgex *devicev1alpha2.EdgeX, component *Component) (*unitv1alpha1.YurtAppSet, error) {
+func (r *EdgeXReconciler) handleYurtAppSet(ctx context.Context, edgex *devicev1alpha2.EdgeX, catalog *devicev1alpha2.VersionCatalog, component *Component) (*unitv1alpha1.YurtAppSet, error) {
 	ud := &unitv1alpha1.YurtAppSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels:      make(map[string]string),
@@ -453,16 +776,11 @@ func (r *EdgeXReconciler) handleYurtAppSet(ctx context.Context, edgex *devicev1a
 	}
 
 	ud.Labels[devicev1alpha2.LabelEdgeXGenerate] = LabelDeployment
-	pool := unitv1alpha1.Pool{
-		Name:     edgex.Spec.PoolName,
-		Replicas: pointer.Int32Ptr(1),
-	}
-	pool.NodeSelectorTerm.MatchExpressions = append(pool.NodeSelectorTerm.MatchExpressions,
-		corev1.NodeSelectorRequirement{
-			Key:      unitv1alpha1.LabelCurrentNodePool,
-			Operator: corev1.NodeSelectorOpIn,
-			Values:   []string{edgex.Spec.PoolName},
-		})
+	ud.Annotations[AnnotationTemplateHash] = templateHash(component.Deployment)
+	pool, err := desiredPool(edgex, component.Deployment, renderDeployment(edgex, catalog, component))
+	if err != nil {
+		return nil, err
+	}
 	ud.Spec.Topology.Pools = append(ud.Spec.Topology.Pools, pool)
 	if err := controllerutil.SetControllerReference(edgex, ud, r.Scheme); err != nil {
 		return nil, err
@@ -470,6 +788,7 @@ func (r *EdgeXReconciler) handleYurtAppSet(ctx context.Context, edgex *devicev1a
 	if err := r.Create(ctx, ud); err != nil {
 		return nil, err
 	}
+	r.eventf(edgex, corev1.EventTypeNormal, devicev1alpha2.YurtAppSetCreatedReason, "created yurtappset %s with pool %s", ud.Name, pool.Name)
 	return ud, nil
 }
 
@@ -528,6 +847,9 @@ func annotationToComponent(annotation map[string]string) ([]*Component, error) {
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *EdgeXReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.APIChecker == nil {
+		r.APIChecker = &APIChecker{}
+	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(ControlledType).
@@ -539,9 +861,61 @@ func (r *EdgeXReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			&source.Kind{Type: &corev1.Service{}},
 			&handler.EnqueueRequestForOwner{OwnerType: ControlledType, IsController: false},
 		).
+		Watches(
+			&source.Kind{Type: &networkingv1.Ingress{}},
+			&handler.EnqueueRequestForOwner{OwnerType: ControlledType, IsController: true},
+		).
 		Watches(
 			&source.Kind{Type: &corev1.ConfigMap{}},
 			&handler.EnqueueRequestForOwner{OwnerType: ControlledType, IsController: false},
 		).
+		Watches(
+			&source.Kind{Type: &devicev1alpha2.EdgeXVersion{}},
+			handler.EnqueueRequestsFromMapFunc(r.edgexesForVersion),
+		).
+		Watches(
+			&source.Channel{Source: r.APIChecker.Events()},
+			&handler.EnqueueRequestForObject{},
+		).
+		Watches(
+			&source.Kind{Type: &devicev1alpha2.Device{}},
+			handler.EnqueueRequestsFromMapFunc(r.edgexesForInventory),
+		).
+		Watches(
+			&source.Kind{Type: &devicev1alpha2.DeviceProfile{}},
+			handler.EnqueueRequestsFromMapFunc(r.edgexesForInventory),
+		).
+		Watches(
+			&source.Kind{Type: &devicev1alpha2.DeviceService{}},
+			handler.EnqueueRequestsFromMapFunc(r.edgexesForInventory),
+		).
 		Complete(r)
 }
+
+// edgexesForInventory maps an object of the device inventory to the edgex of its pool,
+// which exposes core-metadata for it.
+func (r *EdgeXReconciler) edgexesForInventory(obj client.Object) []ctrl.Request {
+	edgexes := &devicev1alpha2.EdgeXList{}
+	if err := r.List(context.TODO(), edgexes, client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{util.IndexerPathForNodepool: inventoryPool(obj)}); err != nil {
+		return nil
+	}
+	requests := make([]ctrl.Request, 0, len(edgexes.Items))
+	for _, edgex := range edgexes.Items {
+		requests = append(requests, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: edgex.Namespace, Name: edgex.Name}})
+	}
+	return requests
+}
+
+// edgexesForVersion maps an EdgeXVersion to the edgexes which use it.
+func (r *EdgeXReconciler) edgexesForVersion(obj client.Object) []ctrl.Request {
+	edgexes := &devicev1alpha2.EdgeXList{}
+	if err := r.List(context.TODO(), edgexes, client.MatchingFields{util.IndexerPathForVersion: obj.GetName()}); err != nil {
+		return nil
+	}
+	requests := make([]ctrl.Request, 0, len(edgexes.Items))
+	for _, edgex := range edgexes.Items {
+		requests = append(requests, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: edgex.Namespace, Name: edgex.Name}})
+	}
+	return requests
+}
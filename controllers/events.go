@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// eventf records an event of the edgex, the events are dropped when the reconciler has no recorder.
+func (r *EdgeXReconciler) eventf(edgex *devicev1alpha2.EdgeX, eventtype, reason, messageFmt string, args ...interface{}) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Eventf(edgex, eventtype, reason, messageFmt, args...)
+}
+
+// recordUpgrade records the start and the rollback of the upgrade against the previous upgrade status.
+func (r *EdgeXReconciler) recordUpgrade(edgex *devicev1alpha2.EdgeX, previous *devicev1alpha2.UpgradeStatus) {
+	upgrade := edgex.Status.Upgrade
+	if upgrade == nil {
+		return
+	}
+	if previous == nil || previous.FromVersion != upgrade.FromVersion || previous.ToVersion != upgrade.ToVersion {
+		r.eventf(edgex, corev1.EventTypeNormal, devicev1alpha2.UpgradeStartedReason,
+			"upgrading from %s to %s", upgrade.FromVersion, upgrade.ToVersion)
+		previous = nil
+	}
+	if upgrade.RolledBack && (previous == nil || !previous.RolledBack) {
+		r.eventf(edgex, corev1.EventTypeWarning, devicev1alpha2.UpgradeRolledBackReason,
+			"the upgrade to %s timed out, rolled back to %s", upgrade.ToVersion, upgrade.FromVersion)
+	}
+}
+
+// recordReadiness records the components whose readiness changed since the previous status.
+func (r *EdgeXReconciler) recordReadiness(edgex *devicev1alpha2.EdgeX, previous, latest []devicev1alpha2.ComponentStatus) {
+	ready := make(map[string]bool, len(previous))
+	for _, status := range previous {
+		ready[status.Name] = status.Ready
+	}
+	for _, status := range latest {
+		switch {
+		case status.Ready && !ready[status.Name]:
+			r.eventf(edgex, corev1.EventTypeNormal, devicev1alpha2.ComponentReadyReason,
+				"component %s is ready in pool %s", status.Name, edgex.Spec.PoolName)
+		case !status.Ready && ready[status.Name]:
+			r.eventf(edgex, corev1.EventTypeWarning, devicev1alpha2.ComponentUnreadyReason,
+				"component %s is not ready in pool %s", status.Name, edgex.Spec.PoolName)
+		}
+	}
+}
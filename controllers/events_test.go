@@ -0,0 +1,103 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// recordedReasons drains the events of the fake recorder and returns their reasons.
+func recordedReasons(recorder *record.FakeRecorder) []string {
+	var reasons []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			// the events are formatted as "<type> <reason> <message>"
+			reasons = append(reasons, strings.Fields(event)[1])
+		default:
+			return reasons
+		}
+	}
+}
+
+func TestComponentEvents(t *testing.T) {
+	catalog := &devicev1alpha2.VersionCatalog{Components: []Component{*testExposedComponent("edgex-core-data", 59880)}}
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default", UID: "beijing"},
+		Spec:       devicev1alpha2.EdgeXSpec{PoolName: "beijing"},
+	}
+	recorder := record.NewFakeRecorder(10)
+	scheme := newTestScheme()
+	r := &EdgeXReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme, Recorder: recorder}
+
+	if _, err := r.reconcileComponent(context.TODO(), edgex, catalog, "", false); err != nil {
+		t.Fatal(err)
+	}
+	reasons := recordedReasons(recorder)
+	if strings.Join(reasons, ",") != devicev1alpha2.ServiceCreatedReason+","+devicev1alpha2.YurtAppSetCreatedReason {
+		t.Fatalf("unexpected events %v", reasons)
+	}
+
+	// the readiness is only recorded when it changes
+	ready := []devicev1alpha2.ComponentStatus{{Name: "edgex-core-data", Ready: true}}
+	r.recordReadiness(edgex, nil, ready)
+	r.recordReadiness(edgex, ready, ready)
+	r.recordReadiness(edgex, ready, []devicev1alpha2.ComponentStatus{{Name: "edgex-core-data"}})
+	reasons = recordedReasons(recorder)
+	if strings.Join(reasons, ",") != devicev1alpha2.ComponentReadyReason+","+devicev1alpha2.ComponentUnreadyReason {
+		t.Fatalf("unexpected events %v", reasons)
+	}
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default"},
+		Spec:       devicev1alpha2.EdgeXSpec{PoolName: "beijing"},
+		Status:     devicev1alpha2.EdgeXStatus{Upgrade: &devicev1alpha2.UpgradeStatus{FromVersion: "jakarta", ToVersion: "kamakura"}},
+	}
+	recorder := record.NewFakeRecorder(10)
+	r := &EdgeXReconciler{Recorder: recorder}
+
+	r.recordUpgrade(edgex, nil)
+	r.recordUpgrade(edgex, edgex.Status.Upgrade.DeepCopy())
+	previous := edgex.Status.Upgrade.DeepCopy()
+	edgex.Status.Upgrade.RolledBack = true
+	r.recordUpgrade(edgex, previous)
+
+	// the deletion is recorded once per step
+	r.markDeleting(edgex, devicev1alpha2.WaitingForPodsDeletionReason, "waiting for the pods in pool %s to be deleted", "beijing")
+	r.markDeleting(edgex, devicev1alpha2.WaitingForPodsDeletionReason, "waiting for the pods in pool %s to be deleted", "beijing")
+	r.markDeleting(edgex, devicev1alpha2.ReleasingResourcesReason, "releasing the resources of pool %s", "beijing")
+
+	expected := []string{
+		devicev1alpha2.UpgradeStartedReason,
+		devicev1alpha2.UpgradeRolledBackReason,
+		devicev1alpha2.WaitingForPodsDeletionReason,
+		devicev1alpha2.ReleasingResourcesReason,
+	}
+	if reasons := recordedReasons(recorder); strings.Join(reasons, ",") != strings.Join(expected, ",") {
+		t.Fatalf("unexpected events %v", reasons)
+	}
+}
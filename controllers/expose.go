@@ -0,0 +1,170 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// componentExpose returns how the component is exposed, nil if it is not exposed. The components
+// routed by the ingress or probed by the API health check are exposed by a ClusterIP service at least.
+func componentExpose(edgex *devicev1alpha2.EdgeX, component *Component) *devicev1alpha2.ComponentExpose {
+	name := component.Name
+	if expose := edgex.Spec.Expose; expose != nil {
+		for i := range expose.Components {
+			if expose.Components[i].Name == name {
+				return &expose.Components[i]
+			}
+		}
+		if expose.Type != "" {
+			return &devicev1alpha2.ComponentExpose{Name: name, Type: expose.Type}
+		}
+	}
+	if ingressRouted(edgex, name) || apiProbed(edgex, component) {
+		return &devicev1alpha2.ComponentExpose{Name: name, Type: corev1.ServiceTypeClusterIP}
+	}
+	return nil
+}
+
+func exposedServiceName(edgex *devicev1alpha2.EdgeX, component string) string {
+	return edgex.Name + "-" + component
+}
+
+// renderExposedService renders the service exposing the component of the edgex. The service of
+// the component is shared by all the pools in the namespace, so the exposed service selects
+// the pods of the edgex by the label added to the pods of the exposed components.
+func renderExposedService(edgex *devicev1alpha2.EdgeX, component *Component, expose *devicev1alpha2.ComponentExpose) *corev1.ServiceSpec {
+	spec := &corev1.ServiceSpec{
+		Type:     expose.Type,
+		Selector: map[string]string{devicev1alpha2.LabelEdgeXName: edgex.Name},
+	}
+	for k, v := range component.Service.Selector {
+		spec.Selector[k] = v
+	}
+
+	for _, port := range component.Service.Ports {
+		port.NodePort = 0
+		if expose.Type != corev1.ServiceTypeClusterIP {
+			for _, pinned := range expose.Ports {
+				if pinned.Port == port.Port {
+					port.NodePort = pinned.NodePort
+				}
+			}
+		}
+		spec.Ports = append(spec.Ports, port)
+	}
+	return spec
+}
+
+// inventoryInPool reports whether devices, device profiles or device services are bound to the pool of the edgex.
+func (r *EdgeXReconciler) inventoryInPool(ctx context.Context, edgex *devicev1alpha2.EdgeX) (bool, error) {
+	for _, list := range []client.ObjectList{&devicev1alpha2.DeviceList{}, &devicev1alpha2.DeviceProfileList{}, &devicev1alpha2.DeviceServiceList{}} {
+		if err := r.List(ctx, list, client.InNamespace(edgex.Namespace)); err != nil {
+			return false, err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return false, err
+		}
+		for _, item := range items {
+			if obj, ok := item.(client.Object); ok && inventoryPool(obj) == edgex.Spec.PoolName {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// handleExposedService creates or updates the service exposing the component, it returns nil if the component is not exposed.
+// core-metadata is exposed by a ClusterIP service at least once the pool has a device inventory to sync to it.
+func (r *EdgeXReconciler) handleExposedService(ctx context.Context, edgex *devicev1alpha2.EdgeX, component *Component) (*corev1.Service, error) {
+	expose := componentExpose(edgex, component)
+	if expose == nil && component.Name == MetadataComponent {
+		inventory, err := r.inventoryInPool(ctx, edgex)
+		if err != nil {
+			return nil, err
+		}
+		if inventory {
+			expose = &devicev1alpha2.ComponentExpose{Name: component.Name, Type: corev1.ServiceTypeClusterIP}
+		}
+	}
+	if expose == nil || component.Service == nil || component.Deployment == nil {
+		return nil, nil
+	}
+
+	desired := renderExposedService(edgex, component, expose)
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      exposedServiceName(edgex, component.Name),
+			Namespace: edgex.Namespace,
+		},
+	}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, service, func() error {
+		if service.Labels == nil {
+			service.Labels = make(map[string]string)
+		}
+		service.Labels[devicev1alpha2.LabelEdgeXGenerate] = LabelExposedService
+		service.Labels[devicev1alpha2.LabelEdgeXName] = edgex.Name
+
+		// The node ports allocated by the cluster are kept
+		for i := range desired.Ports {
+			for _, port := range service.Spec.Ports {
+				if desired.Ports[i].NodePort == 0 && desired.Type != corev1.ServiceTypeClusterIP && port.Port == desired.Ports[i].Port {
+					desired.Ports[i].NodePort = port.NodePort
+				}
+			}
+		}
+		service.Spec.Type = desired.Type
+		service.Spec.Selector = desired.Selector
+		service.Spec.Ports = desired.Ports
+		return controllerutil.SetControllerReference(edgex, service, r.Scheme)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if op == controllerutil.OperationResultCreated {
+		r.eventf(edgex, corev1.EventTypeNormal, devicev1alpha2.ServiceCreatedReason, "created service %s exposing %s", service.Name, component.Name)
+	}
+	return service, nil
+}
+
+// cleanupExposedServices deletes the services of the edgex exposing the components which are not exposed anymore.
+func (r *EdgeXReconciler) cleanupExposedServices(ctx context.Context, edgex *devicev1alpha2.EdgeX, exposed map[string]struct{}) error {
+	services := &corev1.ServiceList{}
+	if err := r.List(ctx, services, client.InNamespace(edgex.Namespace), client.MatchingLabels{
+		devicev1alpha2.LabelEdgeXGenerate: LabelExposedService,
+		devicev1alpha2.LabelEdgeXName:     edgex.Name,
+	}); err != nil {
+		return err
+	}
+	for i := range services.Items {
+		if _, ok := exposed[services.Items[i].Name]; !ok {
+			if err := r.Delete(ctx, &services.Items[i]); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
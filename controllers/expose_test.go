@@ -0,0 +1,156 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func testExposedComponent(name string, port int32) *Component {
+	component := testComponent(name, "openyurt/"+name)
+	component.Service = &corev1.ServiceSpec{
+		Selector: map[string]string{"app": name},
+		Ports:    []corev1.ServicePort{{Name: "http", Port: port}},
+	}
+	return component
+}
+
+func TestRenderExposedService(t *testing.T) {
+	component := testExposedComponent("edgex-ui-go", 4000)
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing"},
+		Spec: devicev1alpha2.EdgeXSpec{
+			PoolName: "beijing",
+			Expose: &devicev1alpha2.Expose{
+				Components: []devicev1alpha2.ComponentExpose{{
+					Name:  "edgex-ui-go",
+					Type:  corev1.ServiceTypeNodePort,
+					Ports: []devicev1alpha2.ExposePort{{Port: 4000, NodePort: 30400}},
+				}},
+			},
+		},
+	}
+
+	expose := componentExpose(edgex, &Component{Name: "edgex-ui-go"})
+	if expose == nil || componentExpose(edgex, &Component{Name: "edgex-core-data"}) != nil {
+		t.Fatal("only edgex-ui-go should be exposed")
+	}
+	spec := renderExposedService(edgex, component, expose)
+	if spec.Type != corev1.ServiceTypeNodePort || spec.Ports[0].NodePort != 30400 {
+		t.Fatalf("unexpected service %v", spec)
+	}
+	if spec.Selector["app"] != "edgex-ui-go" || spec.Selector[devicev1alpha2.LabelEdgeXName] != "edgex-beijing" {
+		t.Fatalf("the service should only select the pods of the edgex, got %v", spec.Selector)
+	}
+	if labels := renderDeployment(edgex, nil, component).Template.Labels; labels[devicev1alpha2.LabelEdgeXName] != "edgex-beijing" {
+		t.Fatalf("the pods should be labelled with the edgex, got %v", labels)
+	}
+
+	// the type of the expose applies to the components not listed
+	edgex.Spec.Expose.Type = corev1.ServiceTypeLoadBalancer
+	if expose := componentExpose(edgex, &Component{Name: "edgex-core-command"}); expose == nil || expose.Type != corev1.ServiceTypeLoadBalancer {
+		t.Fatalf("edgex-core-command should be exposed by a load balancer, got %v", expose)
+	}
+}
+
+func TestHandleExposedService(t *testing.T) {
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default", UID: "beijing"},
+		Spec: devicev1alpha2.EdgeXSpec{
+			PoolName: "beijing",
+			Expose:   &devicev1alpha2.Expose{Type: corev1.ServiceTypeNodePort},
+		},
+	}
+	scheme := newTestScheme()
+	r := &EdgeXReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme}
+
+	exposed := make(map[string]struct{})
+	for _, component := range []*Component{testExposedComponent("edgex-ui-go", 4000), testExposedComponent("edgex-core-command", 59882)} {
+		service, err := r.handleExposedService(context.TODO(), edgex, component)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exposed[service.Name] = struct{}{}
+	}
+	if err := r.cleanupExposedServices(context.TODO(), edgex, exposed); err != nil {
+		t.Fatal(err)
+	}
+
+	services := &corev1.ServiceList{}
+	if err := r.List(context.TODO(), services); err != nil {
+		t.Fatal(err)
+	}
+	if len(services.Items) != 2 {
+		t.Fatalf("expected 2 exposed services, got %d", len(services.Items))
+	}
+
+	// the services are deleted once the components are not exposed
+	delete(exposed, "edgex-beijing-edgex-core-command")
+	if err := r.cleanupExposedServices(context.TODO(), edgex, exposed); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.List(context.TODO(), services); err != nil {
+		t.Fatal(err)
+	}
+	if len(services.Items) != 1 || services.Items[0].Name != "edgex-beijing-edgex-ui-go" {
+		t.Fatalf("unexpected exposed services %v", services.Items)
+	}
+}
+
+func TestExposeMetadataForInventory(t *testing.T) {
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default", UID: "beijing"},
+		Spec:       devicev1alpha2.EdgeXSpec{PoolName: "beijing"},
+	}
+	component := testExposedComponent(MetadataComponent, 59881)
+	hangzhou := &devicev1alpha2.Device{
+		ObjectMeta: metav1.ObjectMeta{Name: "thermometer", Namespace: "default"},
+		Spec:       devicev1alpha2.DeviceSpec{PoolName: "hangzhou"},
+	}
+	scheme := newTestScheme()
+	r := &EdgeXReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(hangzhou).Build(), Scheme: scheme}
+
+	// core-metadata is not exposed as long as the pool has no device inventory
+	if service, err := r.handleExposedService(context.TODO(), edgex, component); err != nil || service != nil {
+		t.Fatalf("expected core-metadata not to be exposed, got %v %v", service, err)
+	}
+	if labels := renderDeployment(edgex, nil, component).Template.Labels; labels[devicev1alpha2.LabelEdgeXName] != edgex.Name {
+		t.Fatalf("the pods of core-metadata should be labelled anyway, got %v", labels)
+	}
+
+	profile := &devicev1alpha2.DeviceProfile{
+		ObjectMeta: metav1.ObjectMeta{Name: "thermometer", Namespace: "default"},
+		Spec:       devicev1alpha2.DeviceProfileSpec{PoolName: "beijing"},
+	}
+	if err := r.Create(context.TODO(), profile); err != nil {
+		t.Fatal(err)
+	}
+	service, err := r.handleExposedService(context.TODO(), edgex, component)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service == nil || service.Name != "edgex-beijing-edgex-core-metadata" || service.Spec.Type != corev1.ServiceTypeClusterIP {
+		t.Fatalf("expected core-metadata to be exposed by ClusterIP, got %v", service)
+	}
+}
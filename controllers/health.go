@@ -0,0 +1,310 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+const (
+	// DefaultAPIHealthCheckPeriod is how often the services are probed when edgex.Spec.APIHealthCheck.Period is not set
+	DefaultAPIHealthCheckPeriod = time.Minute
+	// DefaultAPIHealthCheckTimeout is how long a request may take when edgex.Spec.APIHealthCheck.Timeout is not set
+	DefaultAPIHealthCheckTimeout = 5 * time.Second
+
+	// EdgeXAPIVersion is the version of the REST API the services answer with
+	EdgeXAPIVersion = "v2"
+)
+
+// APIChecker probes the v2 REST API of the services in the pool of an edgex through their exposed services.
+// The services are probed in the background, so that a slow service does not hold the reconciliation,
+// and the edgex is sent to the events channel once its result is ready.
+type APIChecker struct {
+	// Client sends the requests, http.DefaultClient is used when it is nil
+	Client *http.Client
+
+	// Endpoint returns the base URL of the service, the cluster DNS name of the service by default
+	Endpoint func(namespace, name string, port int32) string
+
+	lock    sync.Mutex
+	results map[types.NamespacedName]*apiCheckResult
+	events  chan event.GenericEvent
+}
+
+// apiTarget is a service probed by the API health check
+type apiTarget struct {
+	name    string
+	baseURL string
+}
+
+// apiCheckResult is the latest probing of the services of an edgex
+type apiCheckResult struct {
+	// targets identifies the services probed
+	targets string
+	// services is nil until the first probing is done
+	services []devicev1alpha2.ServiceHealth
+	probing  bool
+	done     time.Time
+}
+
+func targetsKey(targets []apiTarget) string {
+	keys := make([]string, 0, len(targets))
+	for _, target := range targets {
+		keys = append(keys, target.name+"="+target.baseURL)
+	}
+	return strings.Join(keys, ",")
+}
+
+// Events returns the channel the edgexes are sent to once their services are probed.
+func (c *APIChecker) Events() <-chan event.GenericEvent {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.initLocked()
+	return c.events
+}
+
+func (c *APIChecker) initLocked() {
+	if c.results == nil {
+		c.results = make(map[types.NamespacedName]*apiCheckResult)
+	}
+	if c.events == nil {
+		c.events = make(chan event.GenericEvent, 100)
+	}
+}
+
+// result returns the services of the latest probing of the targets of the edgex, nil if there is none
+// yet. A new probing is started when there is none or when it is older than the period.
+func (c *APIChecker) result(edgex *devicev1alpha2.EdgeX, targets []apiTarget, period, timeout time.Duration) []devicev1alpha2.ServiceHealth {
+	key := types.NamespacedName{Namespace: edgex.Namespace, Name: edgex.Name}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.initLocked()
+
+	result, ok := c.results[key]
+	if !ok || result.targets != targetsKey(targets) {
+		// the results of other targets are stale even if a probing of them is still running
+		result = &apiCheckResult{targets: targetsKey(targets)}
+		c.results[key] = result
+	}
+	if !result.probing && (result.services == nil || time.Since(result.done) >= period) {
+		result.probing = true
+		go c.probeAll(edgex.DeepCopy(), result, targets, timeout)
+	}
+	return result.services
+}
+
+// forget drops the result of the edgex.
+func (c *APIChecker) forget(edgex *devicev1alpha2.EdgeX) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.results, types.NamespacedName{Namespace: edgex.Namespace, Name: edgex.Name})
+}
+
+// probeAll probes the targets in parallel, the whole probing takes no longer than a ping and
+// a read of the configuration. The edgex is sent to the events channel once it is done.
+func (c *APIChecker) probeAll(edgex *devicev1alpha2.EdgeX, result *apiCheckResult, targets []apiTarget, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*timeout)
+	defer cancel()
+
+	services := make([]devicev1alpha2.ServiceHealth, len(targets))
+	var wg sync.WaitGroup
+	for i := range targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			latency, err := c.probe(ctx, targets[i].baseURL, timeout)
+			services[i] = devicev1alpha2.ServiceHealth{
+				Name:          targets[i].name,
+				Healthy:       err == nil,
+				Latency:       metav1.Duration{Duration: latency},
+				LastProbeTime: metav1.Now(),
+			}
+			if err != nil {
+				services[i].Message = err.Error()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	c.lock.Lock()
+	result.services, result.probing, result.done = services, false, time.Now()
+	c.lock.Unlock()
+
+	// The edgex is reconciled again after the period anyway
+	select {
+	case c.events <- event.GenericEvent{Object: edgex}:
+	default:
+	}
+}
+
+// apiResponse is the common part of the responses of /api/v2/ping and /api/v2/config
+type apiResponse struct {
+	APIVersion string          `json:"apiVersion"`
+	Config     json.RawMessage `json:"config,omitempty"`
+}
+
+// apiProbed reports whether the API health check of the edgex probes the component.
+func apiProbed(edgex *devicev1alpha2.EdgeX, component *Component) bool {
+	check := edgex.Spec.APIHealthCheck
+	if check == nil {
+		return false
+	}
+	if len(check.Components) == 0 {
+		return component.ResolvedCategory() == devicev1alpha2.CategoryCore
+	}
+	for _, name := range check.Components {
+		if name == component.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceURL returns the base URL of the service by its cluster DNS name.
+func serviceURL(namespace, name string, port int32) string {
+	return fmt.Sprintf("http://%s.%s.svc:%d", name, namespace, port)
+}
+
+func (c *APIChecker) endpoint(namespace, name string, port int32) string {
+	if c.Endpoint != nil {
+		return c.Endpoint(namespace, name, port)
+	}
+	return serviceURL(namespace, name, port)
+}
+
+func (c *APIChecker) get(ctx context.Context, url string, timeout time.Duration) (*apiResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s answered %s", url, resp.Status)
+	}
+	response := &apiResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nil, errors.Wrapf(err, "%s answered an invalid body", url)
+	}
+	if response.APIVersion != EdgeXAPIVersion {
+		return nil, errors.Errorf("%s answered the api version %q", url, response.APIVersion)
+	}
+	return response, nil
+}
+
+// probe pings the service and reads its configuration, the latency is the one of the ping.
+func (c *APIChecker) probe(ctx context.Context, baseURL string, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	if _, err := c.get(ctx, baseURL+"/api/v2/ping", timeout); err != nil {
+		return 0, err
+	}
+	latency := time.Since(start)
+
+	response, err := c.get(ctx, baseURL+"/api/v2/config", timeout)
+	if err != nil {
+		return latency, err
+	}
+	if len(response.Config) == 0 || string(response.Config) == "null" {
+		return latency, errors.Errorf("%s/api/v2/config answered no config", baseURL)
+	}
+	return latency, nil
+}
+
+// checkAPIHealth records the latest probing of the services of the edgex in its status, and starts
+// a new one in the background when it is due. It returns whether all the probed services are healthy,
+// the former result is kept until the first probing of the services is done.
+func (r *EdgeXReconciler) checkAPIHealth(edgex *devicev1alpha2.EdgeX, components []*Component) bool {
+	if r.APIChecker == nil {
+		r.APIChecker = &APIChecker{}
+	}
+	checker := r.APIChecker
+	check := edgex.Spec.APIHealthCheck
+	if check == nil {
+		checker.forget(edgex)
+		conditions.Delete(edgex, devicev1alpha2.EdgeXAPIHealthyCondition)
+		edgex.Status.Services = nil
+		return true
+	}
+	period, timeout := DefaultAPIHealthCheckPeriod, DefaultAPIHealthCheckTimeout
+	if check.Period != nil {
+		period = check.Period.Duration
+	}
+	if check.Timeout != nil {
+		timeout = check.Timeout.Duration
+	}
+
+	var targets []apiTarget
+	for _, component := range components {
+		if component.Service == nil || len(component.Service.Ports) == 0 || !apiProbed(edgex, component) {
+			continue
+		}
+		targets = append(targets, apiTarget{
+			name:    component.Name,
+			baseURL: checker.endpoint(edgex.Namespace, exposedServiceName(edgex, component.Name), component.Service.Ports[0].Port),
+		})
+	}
+	services := checker.result(edgex, targets, period, timeout)
+	if services == nil {
+		return !conditions.IsFalse(edgex, devicev1alpha2.EdgeXAPIHealthyCondition)
+	}
+	edgex.Status.Services = services
+
+	var unhealthy []string
+	for _, health := range services {
+		if !health.Healthy {
+			unhealthy = append(unhealthy, health.Name)
+		}
+	}
+	if len(unhealthy) > 0 {
+		if !conditions.IsFalse(edgex, devicev1alpha2.EdgeXAPIHealthyCondition) {
+			r.eventf(edgex, corev1.EventTypeWarning, devicev1alpha2.APIUnhealthyReason,
+				"the api of %s is not healthy", strings.Join(unhealthy, ","))
+		}
+		conditions.MarkFalse(edgex, devicev1alpha2.EdgeXAPIHealthyCondition, devicev1alpha2.APIUnhealthyReason, clusterv1.ConditionSeverityWarning,
+			"api not healthy: %s", strings.Join(unhealthy, ","))
+		return false
+	}
+	conditions.MarkTrue(edgex, devicev1alpha2.EdgeXAPIHealthyCondition)
+	return true
+}
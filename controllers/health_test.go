@@ -0,0 +1,162 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// newEdgeXAPIServer stands in for the services of the pool, the path of each request is
+// prefixed by the name of the service. core-metadata answers as expected, while core-data
+// is up but fails to read its configuration.
+func newEdgeXAPIServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2)
+		service, path := parts[0], "/"+parts[1]
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case path == "/api/v2/ping":
+			fmt.Fprintf(w, `{"apiVersion":"v2","timestamp":"Mon, 02 May 2022 10:00:00 UTC","serviceName":"%s"}`, service)
+		case path == "/api/v2/config" && service == "edgex-beijing-edgex-core-metadata":
+			fmt.Fprint(w, `{"apiVersion":"v2","config":{"Writable":{"LogLevel":"INFO"}},"serviceName":"core-metadata"}`)
+		case path == "/api/v2/config":
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"apiVersion":"v2","message":"failed to connect to redis","statusCode":500}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// waitAPIHealth waits for the services of the edgex to be probed, and checks the result.
+func waitAPIHealth(t *testing.T, r *EdgeXReconciler, edgex *devicev1alpha2.EdgeX, components []*Component) bool {
+	select {
+	case <-r.APIChecker.Events():
+	case <-time.After(10 * time.Second):
+		t.Fatal("the services are not probed in time")
+	}
+	return r.checkAPIHealth(edgex, components)
+}
+
+func TestCheckAPIHealth(t *testing.T) {
+	server := newEdgeXAPIServer()
+	defer server.Close()
+
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default"},
+		Spec: devicev1alpha2.EdgeXSpec{
+			PoolName:       "beijing",
+			APIHealthCheck: &devicev1alpha2.APIHealthCheck{},
+		},
+	}
+	components := []*Component{
+		testExposedComponent("edgex-core-metadata", 59881),
+		testExposedComponent("edgex-core-data", 59880),
+		testExposedComponent("edgex-ui-go", 4000),
+	}
+	var probed []int32
+	recorder := record.NewFakeRecorder(10)
+	r := &EdgeXReconciler{
+		Recorder: recorder,
+		APIChecker: &APIChecker{
+			Client: server.Client(),
+			Endpoint: func(namespace, name string, port int32) string {
+				probed = append(probed, port)
+				return server.URL + "/" + name
+			},
+		},
+	}
+
+	// the core services are probed by default and exposed to be reachable in the pool
+	if expose := componentExpose(edgex, components[0]); expose == nil || expose.Type != corev1.ServiceTypeClusterIP {
+		t.Fatalf("expected edgex-core-metadata to be exposed by ClusterIP, got %v", expose)
+	}
+	// the former result is kept until the services are probed in the background
+	if !r.checkAPIHealth(edgex, components) || edgex.Status.Services != nil {
+		t.Fatal("expected no result before the services are probed")
+	}
+	if len(probed) != 2 || probed[0] != 59881 || probed[1] != 59880 {
+		t.Fatalf("expected the core services to be probed on their ports, got %v", probed)
+	}
+	if waitAPIHealth(t, r, edgex, components) {
+		t.Fatal("edgex-core-data should not be healthy")
+	}
+
+	services := edgex.Status.Services
+	if len(services) != 2 {
+		t.Fatalf("expected the health of 2 services, got %v", services)
+	}
+	if !services[0].Healthy || services[0].Latency.Duration <= 0 || services[0].LastProbeTime.IsZero() {
+		t.Errorf("expected edgex-core-metadata to be healthy with its latency, got %+v", services[0])
+	}
+	if services[1].Healthy || !strings.Contains(services[1].Message, "500") {
+		t.Errorf("expected edgex-core-data to fail its configuration, got %+v", services[1])
+	}
+	if !conditions.IsFalse(edgex, devicev1alpha2.EdgeXAPIHealthyCondition) ||
+		conditions.GetSeverity(edgex, devicev1alpha2.EdgeXAPIHealthyCondition) == nil ||
+		*conditions.GetSeverity(edgex, devicev1alpha2.EdgeXAPIHealthyCondition) != clusterv1.ConditionSeverityWarning {
+		t.Fatal("expected EdgeXAPIHealthy to be false as a warning")
+	}
+	if reasons := recordedReasons(recorder); len(reasons) != 1 || reasons[0] != devicev1alpha2.APIUnhealthyReason {
+		t.Errorf("expected an %s event, got %v", devicev1alpha2.APIUnhealthyReason, reasons)
+	}
+
+	// the components probed are picked by the check
+	edgex.Spec.APIHealthCheck.Components = []string{"edgex-core-metadata"}
+	r.checkAPIHealth(edgex, components)
+	if !waitAPIHealth(t, r, edgex, components) {
+		t.Fatalf("edgex-core-metadata should be healthy, got %+v", edgex.Status.Services)
+	}
+	if !conditions.IsTrue(edgex, devicev1alpha2.EdgeXAPIHealthyCondition) || len(edgex.Status.Services) != 1 {
+		t.Fatal("expected EdgeXAPIHealthy to be true")
+	}
+
+	// nothing is probed without the check
+	edgex.Spec.APIHealthCheck = nil
+	if !r.checkAPIHealth(edgex, components) || conditions.Has(edgex, devicev1alpha2.EdgeXAPIHealthyCondition) || edgex.Status.Services != nil {
+		t.Fatal("expected the result of the check to be removed")
+	}
+	if componentExpose(edgex, components[1]) != nil {
+		t.Error("edgex-core-data should not be exposed without the check")
+	}
+}
+
+func TestAPICheckerVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, `{"apiVersion":"v1"}`)
+	}))
+	defer server.Close()
+
+	checker := &APIChecker{Client: server.Client()}
+	if _, err := checker.probe(context.TODO(), server.URL, DefaultAPIHealthCheckTimeout); err == nil {
+		t.Fatal("the services not answering the v2 api should not be healthy")
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// ingressPaths returns the paths routed by the ingress of the edgex, the gateway of the version by default.
+func ingressPaths(edgex *devicev1alpha2.EdgeX) []devicev1alpha2.IngressPath {
+	ingress := edgex.Spec.Ingress
+	if ingress == nil {
+		return nil
+	}
+	if len(ingress.Paths) > 0 {
+		return ingress.Paths
+	}
+	return devicev1alpha2.DefaultIngressPaths(edgex.Spec.Security)
+}
+
+// ingressRouted reports whether the component is routed by the ingress of the edgex.
+func ingressRouted(edgex *devicev1alpha2.EdgeX, name string) bool {
+	for _, path := range ingressPaths(edgex) {
+		if path.Component == name {
+			return true
+		}
+	}
+	return false
+}
+
+// renderIngress renders the ingress of the edgex. The paths are routed to the exposed services
+// of the components, which only select the pods in the pool of the edgex. The paths of the
+// components not deployed are left out, and nil is returned when no path is left.
+func renderIngress(edgex *devicev1alpha2.EdgeX, components []*Component) *networkingv1.IngressSpec {
+	ingress := edgex.Spec.Ingress
+	pathType := networkingv1.PathTypePrefix
+	rule := networkingv1.IngressRule{
+		Host:             ingress.Host,
+		IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{}},
+	}
+
+	routed := make(map[string]bool)
+	for _, path := range ingressPaths(edgex) {
+		var component *Component
+		for _, c := range components {
+			if c.Name == path.Component {
+				component = c
+			}
+		}
+		if component == nil || component.Service == nil || len(component.Service.Ports) == 0 || routed[path.Path] {
+			continue
+		}
+		routed[path.Path] = true
+		port := path.Port
+		if port == 0 {
+			port = component.Service.Ports[0].Port
+		}
+		rule.HTTP.Paths = append(rule.HTTP.Paths, networkingv1.HTTPIngressPath{
+			Path:     path.Path,
+			PathType: &pathType,
+			Backend: networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: exposedServiceName(edgex, component.Name),
+					Port: networkingv1.ServiceBackendPort{Number: port},
+				},
+			},
+		})
+	}
+
+	if len(rule.HTTP.Paths) == 0 {
+		return nil
+	}
+
+	spec := &networkingv1.IngressSpec{
+		IngressClassName: ingress.IngressClassName,
+		Rules:            []networkingv1.IngressRule{rule},
+	}
+	if ingress.TLSSecretName != "" {
+		tls := networkingv1.IngressTLS{SecretName: ingress.TLSSecretName}
+		if ingress.Host != "" {
+			tls.Hosts = []string{ingress.Host}
+		}
+		spec.TLS = []networkingv1.IngressTLS{tls}
+	}
+	return spec
+}
+
+// handleIngress creates or updates the ingress of the edgex, and deletes it once edgex.Spec.Ingress is unset
+// or none of its paths is routed to a component deployed.
+func (r *EdgeXReconciler) handleIngress(ctx context.Context, edgex *devicev1alpha2.EdgeX, components []*Component) error {
+	if edgex.Spec.Ingress == nil {
+		return r.deleteIngress(ctx, edgex)
+	}
+
+	desired := renderIngress(edgex, components)
+	if desired == nil {
+		return r.deleteIngress(ctx, edgex)
+	}
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      edgex.Name,
+			Namespace: edgex.Namespace,
+		},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, ingress, func() error {
+		if ingress.Labels == nil {
+			ingress.Labels = make(map[string]string)
+		}
+		ingress.Labels[devicev1alpha2.LabelEdgeXGenerate] = LabelIngress
+		ingress.Labels[devicev1alpha2.LabelEdgeXName] = edgex.Name
+
+		if ingress.Annotations == nil {
+			ingress.Annotations = make(map[string]string)
+		}
+		for k, v := range edgex.Spec.Ingress.Annotations {
+			ingress.Annotations[k] = v
+		}
+		ingress.Spec = *desired
+		return controllerutil.SetControllerReference(edgex, ingress, r.Scheme)
+	})
+	return err
+}
+
+// deleteIngress deletes the ingress generated for the edgex.
+func (r *EdgeXReconciler) deleteIngress(ctx context.Context, edgex *devicev1alpha2.EdgeX) error {
+	ingresses := &networkingv1.IngressList{}
+	if err := r.List(ctx, ingresses, client.InNamespace(edgex.Namespace), client.MatchingLabels{
+		devicev1alpha2.LabelEdgeXGenerate: LabelIngress,
+		devicev1alpha2.LabelEdgeXName:     edgex.Name,
+	}); err != nil {
+		return err
+	}
+	for i := range ingresses.Items {
+		if err := r.Delete(ctx, &ingresses.Items[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
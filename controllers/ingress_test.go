@@ -0,0 +1,133 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func TestRenderIngress(t *testing.T) {
+	components := []*Component{testExposedComponent("edgex-kong", 8000), testExposedComponent("edgex-core-data", 59880)}
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing"},
+		Spec: devicev1alpha2.EdgeXSpec{
+			PoolName: "beijing",
+			Security: true,
+			Ingress:  &devicev1alpha2.Ingress{Host: "beijing.edgex.local", TLSSecretName: "beijing-tls"},
+		},
+	}
+
+	// the gateway is routed by default
+	spec := renderIngress(edgex, components)
+	paths := spec.Rules[0].HTTP.Paths
+	if len(paths) != 1 || paths[0].Path != "/" || paths[0].Backend.Service.Name != "edgex-beijing-edgex-kong" || paths[0].Backend.Service.Port.Number != 8000 {
+		t.Fatalf("unexpected paths %v", paths)
+	}
+	if len(spec.TLS) != 1 || spec.TLS[0].SecretName != "beijing-tls" || spec.TLS[0].Hosts[0] != "beijing.edgex.local" {
+		t.Fatalf("unexpected tls %v", spec.TLS)
+	}
+	if expose := componentExpose(edgex, &Component{Name: "edgex-kong"}); expose == nil || expose.Type != corev1.ServiceTypeClusterIP {
+		t.Fatalf("the gateway should be exposed by a ClusterIP service, got %v", expose)
+	}
+	if componentExpose(edgex, &Component{Name: "edgex-core-data"}) != nil {
+		t.Fatal("edgex-core-data should not be exposed")
+	}
+
+	// the paths of the components not deployed are left out
+	edgex.Spec.Ingress.Paths = []devicev1alpha2.IngressPath{
+		{Path: "/core-data", Component: "edgex-core-data", Port: 59880},
+		{Path: "/", Component: "edgex-ui-go"},
+	}
+	paths = renderIngress(edgex, components).Rules[0].HTTP.Paths
+	if len(paths) != 1 || paths[0].Path != "/core-data" || paths[0].Backend.Service.Name != "edgex-beijing-edgex-core-data" {
+		t.Fatalf("unexpected paths %v", paths)
+	}
+
+	// the gateway is named kong up to hanoi
+	edgex.Spec.Ingress.Paths = nil
+	paths = renderIngress(edgex, []*Component{testExposedComponent("kong", 8000)}).Rules[0].HTTP.Paths
+	if len(paths) != 1 || paths[0].Path != "/" || paths[0].Backend.Service.Name != "edgex-beijing-kong" {
+		t.Fatalf("unexpected paths %v", paths)
+	}
+
+	// nothing is rendered when no path is routed to a component deployed
+	edgex.Spec.Security = false
+	if spec := renderIngress(edgex, components); spec != nil {
+		t.Fatalf("expected no ingress without edgex-ui-go, got %v", spec)
+	}
+}
+
+func TestHandleIngress(t *testing.T) {
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default", UID: "beijing"},
+		Spec: devicev1alpha2.EdgeXSpec{
+			PoolName: "beijing",
+			Ingress:  &devicev1alpha2.Ingress{Annotations: map[string]string{"kubernetes.io/ingress.class": "nginx"}},
+		},
+	}
+	components := []*Component{testExposedComponent("edgex-ui-go", 4000)}
+	scheme := newTestScheme()
+	r := &EdgeXReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme}
+
+	if err := r.handleIngress(context.TODO(), edgex, components); err != nil {
+		t.Fatal(err)
+	}
+	ingresses := &networkingv1.IngressList{}
+	if err := r.List(context.TODO(), ingresses); err != nil {
+		t.Fatal(err)
+	}
+	if len(ingresses.Items) != 1 || ingresses.Items[0].Annotations["kubernetes.io/ingress.class"] != "nginx" {
+		t.Fatalf("unexpected ingresses %v", ingresses.Items)
+	}
+	if owner := metav1.GetControllerOf(&ingresses.Items[0]); owner == nil || owner.UID != edgex.UID {
+		t.Fatal("the ingress should be controlled by the edgex")
+	}
+
+	// the ingress is deleted once none of its paths is routed
+	if err := r.handleIngress(context.TODO(), edgex, []*Component{testExposedComponent("edgex-core-data", 59880)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.List(context.TODO(), ingresses); err != nil {
+		t.Fatal(err)
+	}
+	if len(ingresses.Items) != 0 {
+		t.Fatalf("the ingress without paths should be deleted, got %v", ingresses.Items)
+	}
+	if err := r.handleIngress(context.TODO(), edgex, components); err != nil {
+		t.Fatal(err)
+	}
+
+	// the ingress is deleted once it is unset
+	edgex.Spec.Ingress = nil
+	if err := r.handleIngress(context.TODO(), edgex, components); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.List(context.TODO(), ingresses); err != nil {
+		t.Fatal(err)
+	}
+	if len(ingresses.Items) != 0 {
+		t.Fatalf("the ingress should be deleted, got %v", ingresses.Items)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+const (
+	// MetadataComponent is the component holding the device inventory of an EdgeX
+	MetadataComponent = "edgex-core-metadata"
+
+	// DefaultMetadataSyncPeriod is how often the device inventory is compared with core-metadata
+	DefaultMetadataSyncPeriod = time.Minute
+)
+
+// The objects of the v2 REST API of core-metadata, named after the DTOs of EdgeX.
+// The fields written by EdgeX, e.g. the timestamps, are left out.
+type deviceServiceDTO struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+	devicev1alpha2.DeviceServiceProperties
+}
+
+type deviceProfileDTO struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+	devicev1alpha2.DeviceProfileProperties
+}
+
+type deviceDTO struct {
+	ID             string                        `json:"id,omitempty"`
+	Name           string                        `json:"name"`
+	OperatingState devicev1alpha2.OperatingState `json:"operatingState,omitempty"`
+	devicev1alpha2.DeviceProperties
+}
+
+// metadataRequest wraps an object written to core-metadata, only the field of its kind is set
+type metadataRequest struct {
+	APIVersion string            `json:"apiVersion"`
+	Service    *deviceServiceDTO `json:"service,omitempty"`
+	Profile    *deviceProfileDTO `json:"profile,omitempty"`
+	Device     *deviceDTO        `json:"device,omitempty"`
+}
+
+// metadataResponse is the answer of core-metadata, the object is only set when it is read
+type metadataResponse struct {
+	APIVersion string            `json:"apiVersion"`
+	StatusCode int               `json:"statusCode"`
+	Message    string            `json:"message,omitempty"`
+	ID         string            `json:"id,omitempty"`
+	Service    *deviceServiceDTO `json:"service,omitempty"`
+	Profile    *deviceProfileDTO `json:"profile,omitempty"`
+	Device     *deviceDTO        `json:"device,omitempty"`
+}
+
+// metadataClient talks to the v2 REST API of core-metadata
+type metadataClient struct {
+	// Client sends the requests, http.DefaultClient is used when it is nil
+	Client *http.Client
+
+	// BaseURL of core-metadata, e.g. http://edgex-beijing-edgex-core-metadata.default.svc:59881
+	BaseURL string
+}
+
+func (c *metadataClient) do(ctx context.Context, method, path string, body interface{}, out interface{}) (int, error) {
+	content := &bytes.Buffer{}
+	if body != nil {
+		if err := json.NewEncoder(content).Encode(body); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, content)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		failure := &metadataResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(failure); err != nil || failure.Message == "" {
+			return resp.StatusCode, errors.Errorf("%s %s answered %s", method, path, resp.Status)
+		}
+		return resp.StatusCode, errors.Errorf("%s %s answered %s: %s", method, path, resp.Status, failure.Message)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, errors.Wrapf(err, "%s %s answered an invalid body", method, path)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// get reads an object by its name, nil is returned when it does not exist.
+func (c *metadataClient) get(ctx context.Context, kind, name string) (*metadataResponse, error) {
+	response := &metadataResponse{}
+	code, err := c.do(ctx, http.MethodGet, "/api/v2/"+kind+"/name/"+url.PathEscape(name), nil, response)
+	if code == http.StatusNotFound {
+		return nil, nil
+	}
+	return response, err
+}
+
+// write adds or updates an object, core-metadata answers each request of the batch separately
+// and the id of an added object is returned.
+func (c *metadataClient) write(ctx context.Context, method, kind string, request metadataRequest) (string, error) {
+	request.APIVersion = EdgeXAPIVersion
+	var responses []metadataResponse
+	if _, err := c.do(ctx, method, "/api/v2/"+kind, []metadataRequest{request}, &responses); err != nil {
+		return "", err
+	}
+	if len(responses) != 1 {
+		return "", errors.Errorf("%s /api/v2/%s answered %d responses to 1 request", method, kind, len(responses))
+	}
+	if code := responses[0].StatusCode; code < http.StatusOK || code >= http.StatusMultipleChoices {
+		return "", errors.Errorf("%s /api/v2/%s answered %d: %s", method, kind, code, responses[0].Message)
+	}
+	return responses[0].ID, nil
+}
+
+// remove deletes an object by its name, an object which does not exist is already removed.
+func (c *metadataClient) remove(ctx context.Context, kind, name string) error {
+	code, err := c.do(ctx, http.MethodDelete, "/api/v2/"+kind+"/name/"+url.PathEscape(name), nil, nil)
+	if code == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (c *metadataClient) GetDeviceService(ctx context.Context, name string) (*deviceServiceDTO, error) {
+	response, err := c.get(ctx, "deviceservice", name)
+	if response == nil || err != nil {
+		return nil, err
+	}
+	return response.Service, nil
+}
+
+func (c *metadataClient) AddDeviceService(ctx context.Context, service *deviceServiceDTO) (string, error) {
+	return c.write(ctx, http.MethodPost, "deviceservice", metadataRequest{Service: service})
+}
+
+func (c *metadataClient) UpdateDeviceService(ctx context.Context, service *deviceServiceDTO) error {
+	_, err := c.write(ctx, http.MethodPatch, "deviceservice", metadataRequest{Service: service})
+	return err
+}
+
+func (c *metadataClient) DeleteDeviceService(ctx context.Context, name string) error {
+	return c.remove(ctx, "deviceservice", name)
+}
+
+func (c *metadataClient) GetDeviceProfile(ctx context.Context, name string) (*deviceProfileDTO, error) {
+	response, err := c.get(ctx, "deviceprofile", name)
+	if response == nil || err != nil {
+		return nil, err
+	}
+	return response.Profile, nil
+}
+
+func (c *metadataClient) AddDeviceProfile(ctx context.Context, profile *deviceProfileDTO) (string, error) {
+	return c.write(ctx, http.MethodPost, "deviceprofile", metadataRequest{Profile: profile})
+}
+
+// UpdateDeviceProfile replaces the device profile, core-metadata does not patch the profiles.
+func (c *metadataClient) UpdateDeviceProfile(ctx context.Context, profile *deviceProfileDTO) error {
+	_, err := c.write(ctx, http.MethodPut, "deviceprofile", metadataRequest{Profile: profile})
+	return err
+}
+
+func (c *metadataClient) DeleteDeviceProfile(ctx context.Context, name string) error {
+	return c.remove(ctx, "deviceprofile", name)
+}
+
+func (c *metadataClient) GetDevice(ctx context.Context, name string) (*deviceDTO, error) {
+	response, err := c.get(ctx, "device", name)
+	if response == nil || err != nil {
+		return nil, err
+	}
+	return response.Device, nil
+}
+
+func (c *metadataClient) AddDevice(ctx context.Context, device *deviceDTO) (string, error) {
+	return c.write(ctx, http.MethodPost, "device", metadataRequest{Device: device})
+}
+
+// UpdateDevice patches the device, the operating state is left to the device service.
+func (c *metadataClient) UpdateDevice(ctx context.Context, device *deviceDTO) error {
+	patch := *device
+	patch.OperatingState = ""
+	_, err := c.write(ctx, http.MethodPatch, "device", metadataRequest{Device: &patch})
+	return err
+}
+
+func (c *metadataClient) DeleteDevice(ctx context.Context, name string) error {
+	return c.remove(ctx, "device", name)
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// inventoryObject is a device, a device profile or a device service
+type inventoryObject interface {
+	client.Object
+	conditions.Setter
+}
+
+// MetadataSync is shared by the reconcilers which sync the device inventory to core-metadata
+// of the EdgeX of its pool. core-metadata is reached through the service exposing it in the pool.
+type MetadataSync struct {
+	client.Client
+	Recorder record.EventRecorder
+
+	// HTTPClient sends the requests, http.DefaultClient is used when it is nil
+	HTTPClient *http.Client
+
+	// Endpoint returns the base URL of the service, the cluster DNS name of the service by default
+	Endpoint func(namespace, name string, port int32) string
+}
+
+func (s *MetadataSync) eventf(obj client.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if s.Recorder != nil {
+		s.Recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+	}
+}
+
+// inventoryPool returns the pool the object of the device inventory is bound to.
+func inventoryPool(obj client.Object) string {
+	switch o := obj.(type) {
+	case *devicev1alpha2.Device:
+		return o.Spec.PoolName
+	case *devicev1alpha2.DeviceProfile:
+		return o.Spec.PoolName
+	case *devicev1alpha2.DeviceService:
+		return o.Spec.PoolName
+	}
+	return ""
+}
+
+// metadataFor returns the edgex of the pool and the client of its core-metadata. The edgex is nil when
+// the pool has none, and the client is nil as long as core-metadata is not ready in the pool.
+func (s *MetadataSync) metadataFor(ctx context.Context, namespace, poolName string) (*devicev1alpha2.EdgeX, *metadataClient, error) {
+	edgexes := &devicev1alpha2.EdgeXList{}
+	if err := s.List(ctx, edgexes, client.InNamespace(namespace)); err != nil {
+		return nil, nil, err
+	}
+	var edgex *devicev1alpha2.EdgeX
+	for i := range edgexes.Items {
+		if edgexes.Items[i].Spec.PoolName == poolName && edgexes.Items[i].DeletionTimestamp.IsZero() {
+			edgex = &edgexes.Items[i]
+		}
+	}
+	if edgex == nil {
+		return nil, nil, nil
+	}
+
+	ready := false
+	for _, status := range edgex.Status.Components {
+		if status.Name == MetadataComponent {
+			ready = status.Ready
+		}
+	}
+	if !ready {
+		return edgex, nil, nil
+	}
+
+	version := edgex.Status.Version
+	if version == "" {
+		version = edgex.Spec.Version
+	}
+	catalog, err := versionCatalog(ctx, s.Client, version, edgex.Spec.Security)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range catalog.Components {
+		component := &catalog.Components[i]
+		if component.Name != MetadataComponent || component.Service == nil || len(component.Service.Ports) == 0 {
+			continue
+		}
+		name, port := exposedServiceName(edgex, component.Name), component.Service.Ports[0].Port
+		baseURL := serviceURL(edgex.Namespace, name, port)
+		if s.Endpoint != nil {
+			baseURL = s.Endpoint(edgex.Namespace, name, port)
+		}
+		return edgex, &metadataClient{Client: s.HTTPClient, BaseURL: baseURL}, nil
+	}
+	return nil, nil, errors.Errorf("%s has no service in version %s", MetadataComponent, version)
+}
+
+// reconcileInventory syncs the object to core-metadata of the edgex of its pool with sync, and removes
+// it from core-metadata with remove once it is deleted. The object is compared with core-metadata
+// periodically, so that its state in core-metadata is mirrored in its status.
+func (s *MetadataSync) reconcileInventory(ctx context.Context, obj inventoryObject, sync, remove func(*metadataClient) error) (_ ctrl.Result, reterr error) {
+	patchHelper, err := patch.NewHelper(obj, s.Client)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to init patch helper for %s/%s", obj.GetNamespace(), obj.GetName())
+	}
+	defer func() {
+		if err := patchHelper.Patch(ctx, obj); err != nil {
+			reterr = kerrors.NewAggregate([]error{reterr, err})
+		}
+	}()
+
+	poolName := inventoryPool(obj)
+	edgex, metadata, err := s.metadataFor(ctx, obj.GetNamespace(), poolName)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// core-metadata is never ready in the pool when the edgex does not deploy it
+	deployed := edgex != nil && edgex.Deploys(MetadataComponent)
+
+	if !obj.GetDeletionTimestamp().IsZero() {
+		// Nothing is left to remove once the edgex of the pool is gone or has no core-metadata
+		if deployed {
+			if metadata == nil {
+				return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+			}
+			if err := remove(metadata); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		controllerutil.RemoveFinalizer(obj, devicev1alpha2.MetadataFinalizer)
+		return ctrl.Result{}, nil
+	}
+	controllerutil.AddFinalizer(obj, devicev1alpha2.MetadataFinalizer)
+
+	if !deployed {
+		// The object is synced once the edgex deploys core-metadata, the changes of the edgex are watched
+		conditions.MarkFalse(obj, devicev1alpha2.MetadataSyncedCondition, devicev1alpha2.MetadataUnavailableReason, clusterv1.ConditionSeverityWarning,
+			"core-metadata is not deployed in pool %s", poolName)
+		return ctrl.Result{}, nil
+	}
+	if metadata == nil {
+		conditions.MarkFalse(obj, devicev1alpha2.MetadataSyncedCondition, devicev1alpha2.MetadataUnavailableReason, clusterv1.ConditionSeverityInfo,
+			"core-metadata of pool %s is not ready", poolName)
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+	if err := sync(metadata); err != nil {
+		conditions.MarkFalse(obj, devicev1alpha2.MetadataSyncedCondition, devicev1alpha2.MetadataSyncFailedReason, clusterv1.ConditionSeverityWarning, "%v", err)
+		s.eventf(obj, corev1.EventTypeWarning, devicev1alpha2.MetadataSyncFailedReason, "%v", err)
+		return ctrl.Result{}, err
+	}
+	conditions.MarkTrue(obj, devicev1alpha2.MetadataSyncedCondition)
+	return ctrl.Result{RequeueAfter: DefaultMetadataSyncPeriod}, nil
+}
+
+// requestsForEdgeX maps an edgex to the objects of the device inventory bound to its pool,
+// so that they are synced as soon as core-metadata is ready.
+func (s *MetadataSync) requestsForEdgeX(newList func() client.ObjectList) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		edgex, ok := obj.(*devicev1alpha2.EdgeX)
+		if !ok {
+			return nil
+		}
+		list := newList()
+		if err := s.List(context.TODO(), list, client.InNamespace(edgex.Namespace)); err != nil {
+			return nil
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, item := range items {
+			o, ok := item.(client.Object)
+			if ok && inventoryPool(o) == edgex.Spec.PoolName {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: o.GetNamespace(), Name: o.GetName()}})
+			}
+		}
+		return requests
+	}
+}
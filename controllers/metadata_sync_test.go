@@ -0,0 +1,394 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// fakeMetadata stands in for the v2 REST API of core-metadata, the objects are kept as they are written.
+type fakeMetadata struct {
+	sync.Mutex
+	objects map[string]map[string]json.RawMessage
+	calls   []string
+}
+
+func newFakeMetadata() *fakeMetadata {
+	return &fakeMetadata{objects: map[string]map[string]json.RawMessage{
+		"deviceservice": {}, "deviceprofile": {}, "device": {},
+	}}
+}
+
+// field is the field wrapping the object of the kind in the requests and the responses
+var fakeMetadataFields = map[string]string{"deviceservice": "service", "deviceprofile": "profile", "device": "device"}
+
+func (m *fakeMetadata) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+	m.calls = append(m.calls, req.Method+" "+req.URL.Path)
+
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/api/v2/"), "/")
+	objects, ok := m.objects[parts[0]]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	field := fakeMetadataFields[parts[0]]
+
+	if len(parts) == 3 && parts[1] == "name" {
+		object, ok := objects[parts[2]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"apiVersion":"v2","statusCode":404,"message":"%s %s does not exist"}`, parts[0], parts[2])
+			return
+		}
+		switch req.Method {
+		case http.MethodGet:
+			fmt.Fprintf(w, `{"apiVersion":"v2","statusCode":200,"%s":%s}`, field, object)
+		case http.MethodDelete:
+			delete(objects, parts[2])
+			fmt.Fprint(w, `{"apiVersion":"v2","statusCode":200}`)
+		}
+		return
+	}
+
+	var requests []map[string]json.RawMessage
+	if err := json.NewDecoder(req.Body).Decode(&requests); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var responses []map[string]interface{}
+	for _, request := range requests {
+		object := map[string]interface{}{}
+		_ = json.Unmarshal(request[field], &object)
+		name := object["name"].(string)
+		existing, found := objects[name]
+		switch {
+		case req.Method == http.MethodPost && found:
+			responses = append(responses, map[string]interface{}{"apiVersion": "v2", "statusCode": 409, "message": "duplicate name"})
+			continue
+		case req.Method == http.MethodPost:
+			object["id"] = "id-" + name
+		case !found:
+			responses = append(responses, map[string]interface{}{"apiVersion": "v2", "statusCode": 404, "message": "not found"})
+			continue
+		case req.Method == http.MethodPatch:
+			// a patch only sets the fields in the request
+			patched := map[string]interface{}{}
+			_ = json.Unmarshal(existing, &patched)
+			for k, v := range object {
+				patched[k] = v
+			}
+			object = patched
+		default:
+			object["id"] = "id-" + name
+		}
+		objects[name], _ = json.Marshal(object)
+		responses = append(responses, map[string]interface{}{"apiVersion": "v2", "statusCode": 201, "id": object["id"]})
+	}
+	w.WriteHeader(http.StatusMultiStatus)
+	_ = json.NewEncoder(w).Encode(responses)
+}
+
+// setDeviceField plays a change of the device made in core-metadata, e.g. the device service
+// reporting the state of the device.
+func (m *fakeMetadata) setDeviceField(name, field string, value interface{}) {
+	m.Lock()
+	defer m.Unlock()
+	device := map[string]interface{}{}
+	_ = json.Unmarshal(m.objects["device"][name], &device)
+	device[field] = value
+	m.objects["device"][name], _ = json.Marshal(device)
+}
+
+func (m *fakeMetadata) get(kind, name string, v interface{}) bool {
+	m.Lock()
+	defer m.Unlock()
+	object, ok := m.objects[kind][name]
+	if ok {
+		_ = json.Unmarshal(object, v)
+	}
+	return ok
+}
+
+func (m *fakeMetadata) takeCalls() []string {
+	m.Lock()
+	defer m.Unlock()
+	calls := m.calls
+	m.calls = nil
+	return calls
+}
+
+func TestMetadataSync(t *testing.T) {
+	metadata := newFakeMetadata()
+	server := httptest.NewServer(metadata)
+	defer server.Close()
+
+	metadataComponent := testExposedComponent(MetadataComponent, 59881)
+	version := &devicev1alpha2.EdgeXVersion{
+		ObjectMeta: metav1.ObjectMeta{Name: "jakarta"},
+		Spec:       devicev1alpha2.EdgeXVersionSpec{NoSecty: devicev1alpha2.VersionCatalog{Components: []Component{*metadataComponent}}},
+	}
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default"},
+		Spec:       devicev1alpha2.EdgeXSpec{Version: "jakarta", PoolName: "beijing"},
+		Status: devicev1alpha2.EdgeXStatus{
+			Version:    "jakarta",
+			Components: []devicev1alpha2.ComponentStatus{{Name: MetadataComponent}},
+		},
+	}
+	service := &devicev1alpha2.DeviceService{
+		ObjectMeta: metav1.ObjectMeta{Name: "device-virtual", Namespace: "default"},
+		Spec: devicev1alpha2.DeviceServiceSpec{
+			PoolName:                "beijing",
+			DeviceServiceProperties: devicev1alpha2.DeviceServiceProperties{BaseAddress: "http://edgex-device-virtual:59900"},
+		},
+	}
+	profile := &devicev1alpha2.DeviceProfile{
+		ObjectMeta: metav1.ObjectMeta{Name: "random-integer", Namespace: "default"},
+		Spec: devicev1alpha2.DeviceProfileSpec{
+			PoolName: "beijing",
+			DeviceProfileProperties: devicev1alpha2.DeviceProfileProperties{
+				Manufacturer: "IOTech",
+				DeviceResources: []devicev1alpha2.DeviceResource{{
+					Name:       "Int8",
+					Properties: devicev1alpha2.ResourceProperties{ValueType: "Int8", ReadWrite: "RW"},
+				}},
+			},
+		},
+	}
+	device := &devicev1alpha2.Device{
+		ObjectMeta: metav1.ObjectMeta{Name: "random-integer-device", Namespace: "default"},
+		Spec: devicev1alpha2.DeviceSpec{
+			PoolName: "beijing",
+			DeviceProperties: devicev1alpha2.DeviceProperties{
+				ServiceName: "device-virtual",
+				ProfileName: "random-integer",
+				AutoEvents:  []devicev1alpha2.AutoEvent{{Interval: "10s", SourceName: "Int8"}},
+				Protocols:   map[string]devicev1alpha2.ProtocolProperties{"other": {"Address": "simple01"}},
+			},
+		},
+	}
+
+	scheme := newTestScheme()
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(version, edgex, service, profile, device).Build()
+	var endpoint string
+	metadataSync := MetadataSync{
+		Client:     c,
+		HTTPClient: server.Client(),
+		Endpoint: func(namespace, name string, port int32) string {
+			endpoint = fmt.Sprintf("%s/%s:%d", namespace, name, port)
+			return server.URL
+		},
+	}
+	reconcile := func(r interface {
+		Reconcile(context.Context, ctrl.Request) (ctrl.Result, error)
+	}, obj client.Object) {
+		t.Helper()
+		if _, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(obj)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Get(context.TODO(), client.ObjectKeyFromObject(obj), obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	serviceReconciler := &DeviceServiceReconciler{MetadataSync: metadataSync}
+	profileReconciler := &DeviceProfileReconciler{MetadataSync: metadataSync}
+	deviceReconciler := &DeviceReconciler{MetadataSync: metadataSync}
+
+	// nothing is synced until core-metadata is ready in the pool
+	reconcile(serviceReconciler, service)
+	if !controllerutil.ContainsFinalizer(service, devicev1alpha2.MetadataFinalizer) {
+		t.Fatal("expected the finalizer to be added")
+	}
+	if conditions.GetReason(service, devicev1alpha2.MetadataSyncedCondition) != devicev1alpha2.MetadataUnavailableReason {
+		t.Fatalf("expected the sync to wait for core-metadata, got %v", service.Status.Conditions)
+	}
+	if calls := metadata.takeCalls(); len(calls) != 0 {
+		t.Fatalf("expected no call to core-metadata, got %v", calls)
+	}
+
+	edgex.Status.Components[0].Ready = true
+	if err := c.Update(context.TODO(), edgex); err != nil {
+		t.Fatal(err)
+	}
+	reconcile(serviceReconciler, service)
+	reconcile(profileReconciler, profile)
+	reconcile(deviceReconciler, device)
+	if endpoint != "default/edgex-beijing-edgex-core-metadata:59881" {
+		t.Errorf("expected core-metadata to be reached through its exposed service, got %s", endpoint)
+	}
+	if !conditions.IsTrue(service, devicev1alpha2.MetadataSyncedCondition) || service.Status.EdgeXID != "id-device-virtual" ||
+		service.Status.AdminState != devicev1alpha2.Unlocked {
+		t.Errorf("expected the device service to be synced, got %+v", service.Status)
+	}
+	if !conditions.IsTrue(profile, devicev1alpha2.MetadataSyncedCondition) || profile.Status.EdgeXID != "id-random-integer" {
+		t.Errorf("expected the device profile to be synced, got %+v", profile.Status)
+	}
+	if !conditions.IsTrue(device, devicev1alpha2.MetadataSyncedCondition) || device.Status.OperatingState != devicev1alpha2.Up ||
+		device.Status.AdminState != devicev1alpha2.Unlocked {
+		t.Errorf("expected the device to be synced, got %+v", device.Status)
+	}
+	stored := &deviceDTO{}
+	if !metadata.get("device", device.Name, stored) || stored.ProfileName != "random-integer" || stored.Protocols["other"]["Address"] != "simple01" {
+		t.Fatalf("expected the device in core-metadata, got %+v", stored)
+	}
+	metadata.takeCalls()
+
+	// the state reported by the device service is mirrored, the device is left as it is
+	metadata.setDeviceField(device.Name, "operatingState", devicev1alpha2.Down)
+	reconcile(deviceReconciler, device)
+	if device.Status.OperatingState != devicev1alpha2.Down {
+		t.Errorf("expected the operating state to be mirrored, got %s", device.Status.OperatingState)
+	}
+	if calls := metadata.takeCalls(); len(calls) != 1 || calls[0] != "GET /api/v2/device/name/random-integer-device" {
+		t.Errorf("expected the device in sync to be only read, got %v", calls)
+	}
+
+	// the changes of the spec are pushed to core-metadata
+	device.Spec.AdminState = devicev1alpha2.Locked
+	if err := c.Update(context.TODO(), device); err != nil {
+		t.Fatal(err)
+	}
+	reconcile(deviceReconciler, device)
+	if !metadata.get("device", device.Name, stored) || stored.AdminState != devicev1alpha2.Locked || stored.OperatingState != devicev1alpha2.Down {
+		t.Errorf("expected the device to be locked keeping its operating state, got %+v", stored)
+	}
+	if device.Status.AdminState != devicev1alpha2.Locked {
+		t.Errorf("expected the admin state to be mirrored, got %s", device.Status.AdminState)
+	}
+
+	// the spec owns the admin state, the changes made in core-metadata are reverted
+	metadata.setDeviceField(device.Name, "adminState", devicev1alpha2.Unlocked)
+	reconcile(deviceReconciler, device)
+	if !metadata.get("device", device.Name, stored) || stored.AdminState != devicev1alpha2.Locked {
+		t.Errorf("expected the device to be locked again, got %+v", stored)
+	}
+	profile.Spec.Model = "virtual"
+	if err := c.Update(context.TODO(), profile); err != nil {
+		t.Fatal(err)
+	}
+	reconcile(profileReconciler, profile)
+	storedProfile := &deviceProfileDTO{}
+	if !metadata.get("deviceprofile", profile.Name, storedProfile) || storedProfile.Model != "virtual" || storedProfile.ID != "id-random-integer" {
+		t.Errorf("expected the device profile to be replaced, got %+v", storedProfile)
+	}
+
+	// the device is removed from core-metadata once it is deleted
+	if err := c.Delete(context.TODO(), device); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: device.Name}, device); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := deviceReconciler.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(device)}); err != nil {
+		t.Fatal(err)
+	}
+	if metadata.get("device", device.Name, stored) {
+		t.Error("expected the device to be removed from core-metadata")
+	}
+	err := c.Get(context.TODO(), client.ObjectKeyFromObject(device), device)
+	if err == nil && controllerutil.ContainsFinalizer(device, devicev1alpha2.MetadataFinalizer) {
+		t.Error("expected the finalizer to be removed")
+	} else if err != nil && !apierrors.IsNotFound(err) {
+		t.Fatal(err)
+	}
+}
+
+func TestMetadataSyncFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `[{"apiVersion":"v2","statusCode":404,"message":"device service device-virtual does not exist"}]`)
+	}))
+	defer server.Close()
+
+	device := &devicev1alpha2.Device{
+		ObjectMeta: metav1.ObjectMeta{Name: "random-integer-device"},
+		Spec:       devicev1alpha2.DeviceSpec{DeviceProperties: devicev1alpha2.DeviceProperties{ServiceName: "device-virtual"}},
+	}
+	err := syncDevice(context.TODO(), &metadataClient{Client: server.Client(), BaseURL: server.URL}, device)
+	if err == nil || !strings.Contains(err.Error(), "device-virtual does not exist") {
+		t.Fatalf("expected the failure of core-metadata to be reported, got %v", err)
+	}
+}
+
+func TestMetadataSyncNotDeployed(t *testing.T) {
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default"},
+		Spec: devicev1alpha2.EdgeXSpec{
+			Version:    "jakarta",
+			PoolName:   "beijing",
+			Components: []devicev1alpha2.Component{{Name: MetadataComponent, Enabled: pointer.BoolPtr(false)}},
+		},
+	}
+	device := &devicev1alpha2.Device{
+		ObjectMeta: metav1.ObjectMeta{Name: "random-integer-device", Namespace: "default"},
+		Spec:       devicev1alpha2.DeviceSpec{PoolName: "beijing"},
+	}
+	c := fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(edgex, device).Build()
+	r := &DeviceReconciler{MetadataSync: MetadataSync{Client: c}}
+	request := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(device)}
+
+	// the device waits for the edgex to deploy core-metadata rather than polling it
+	result, err := r.Reconcile(context.TODO(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(context.TODO(), request.NamespacedName, device); err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter != 0 || conditions.GetReason(device, devicev1alpha2.MetadataSyncedCondition) != devicev1alpha2.MetadataUnavailableReason {
+		t.Fatalf("expected the sync to wait for core-metadata to be deployed, got %v %v", result, device.Status.Conditions)
+	}
+
+	// the device is released once deleted, there is no core-metadata to remove it from
+	if err := c.Delete(context.TODO(), device); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = r.Reconcile(context.TODO(), request); err != nil || result.RequeueAfter != 0 {
+		t.Fatalf("expected the device to be released, got %v %v", result, err)
+	}
+	err = c.Get(context.TODO(), request.NamespacedName, device)
+	if err == nil && controllerutil.ContainsFinalizer(device, devicev1alpha2.MetadataFinalizer) {
+		t.Error("expected the finalizer to be removed")
+	} else if err != nil && !apierrors.IsNotFound(err) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// The phases of the reconcile whose durations are observed
+const (
+	PhaseConfigmap = "configmap"
+	PhaseComponent = "component"
+)
+
+var edgexLabels = []string{"namespace", "name", "pool", "version", "security"}
+
+var (
+	readyComponentsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "edgex_ready_components",
+		Help: "Number of the components of the EdgeX which are ready in its pool",
+	}, edgexLabels)
+
+	unreadyComponentsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "edgex_unready_components",
+		Help: "Number of the components of the EdgeX which are not ready in its pool",
+	}, edgexLabels)
+
+	componentReadyGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "edgex_component_ready",
+		Help: "Whether the component of the EdgeX is ready in its pool",
+	}, []string{"namespace", "name", "pool", "component"})
+
+	reconcilePhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "edgex_reconcile_phase_duration_seconds",
+		Help:    "Duration of the phases of the EdgeX reconcile",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"phase"})
+
+	provisioningFailuresCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "edgex_provisioning_failures_total",
+		Help: "Number of the failures provisioning the EdgeX",
+	}, []string{"namespace", "name", "pool", "reason"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		readyComponentsGauge,
+		unreadyComponentsGauge,
+		componentReadyGauge,
+		reconcilePhaseDuration,
+		provisioningFailuresCounter,
+	)
+}
+
+// recordedMetrics is what was last recorded for an edgex, so that the stale series are
+// deleted once the version or the components of the edgex change.
+type recordedMetrics struct {
+	labels     prometheus.Labels
+	components map[string]prometheus.Labels
+}
+
+var (
+	recordedLock sync.Mutex
+	recorded     = make(map[types.NamespacedName]*recordedMetrics)
+)
+
+func edgexMetricLabels(edgex *devicev1alpha2.EdgeX) prometheus.Labels {
+	version := edgex.Status.Version
+	if version == "" {
+		version = edgex.Spec.Version
+	}
+	return prometheus.Labels{
+		"namespace": edgex.Namespace,
+		"name":      edgex.Name,
+		"pool":      edgex.Spec.PoolName,
+		"version":   version,
+		"security":  strconv.FormatBool(edgex.Spec.Security),
+	}
+}
+
+// recordEdgeXMetrics records the readiness of the edgex and its components.
+func recordEdgeXMetrics(edgex *devicev1alpha2.EdgeX) {
+	recordedLock.Lock()
+	defer recordedLock.Unlock()
+
+	key := types.NamespacedName{Namespace: edgex.Namespace, Name: edgex.Name}
+	previous := recorded[key]
+	current := &recordedMetrics{
+		labels:     edgexMetricLabels(edgex),
+		components: make(map[string]prometheus.Labels, len(edgex.Status.Components)),
+	}
+
+	readyComponentsGauge.With(current.labels).Set(float64(edgex.Status.ReadyComponentNum))
+	unreadyComponentsGauge.With(current.labels).Set(float64(edgex.Status.UnreadyComponentNum))
+	for _, status := range edgex.Status.Components {
+		labels := prometheus.Labels{
+			"namespace": edgex.Namespace,
+			"name":      edgex.Name,
+			"pool":      edgex.Spec.PoolName,
+			"component": status.Name,
+		}
+		ready := 0.0
+		if status.Ready {
+			ready = 1
+		}
+		componentReadyGauge.With(labels).Set(ready)
+		current.components[status.Name] = labels
+	}
+
+	if previous != nil {
+		if !equalLabels(previous.labels, current.labels) {
+			readyComponentsGauge.Delete(previous.labels)
+			unreadyComponentsGauge.Delete(previous.labels)
+		}
+		for name, labels := range previous.components {
+			if _, ok := current.components[name]; !ok {
+				componentReadyGauge.Delete(labels)
+			}
+		}
+	}
+	recorded[key] = current
+}
+
+// forgetEdgeXMetrics deletes the series of the edgex once it is deleted.
+func forgetEdgeXMetrics(edgex *devicev1alpha2.EdgeX) {
+	recordedLock.Lock()
+	defer recordedLock.Unlock()
+
+	key := types.NamespacedName{Namespace: edgex.Namespace, Name: edgex.Name}
+	if previous, ok := recorded[key]; ok {
+		readyComponentsGauge.Delete(previous.labels)
+		unreadyComponentsGauge.Delete(previous.labels)
+		for _, labels := range previous.components {
+			componentReadyGauge.Delete(labels)
+		}
+		delete(recorded, key)
+	}
+	for _, reason := range []string{devicev1alpha2.ConfigmapProvisioningFailedReason, devicev1alpha2.ComponentProvisioningFailedReason} {
+		provisioningFailuresCounter.DeleteLabelValues(edgex.Namespace, edgex.Name, edgex.Spec.PoolName, reason)
+	}
+}
+
+// countProvisioningFailure counts a failure provisioning the edgex.
+func countProvisioningFailure(edgex *devicev1alpha2.EdgeX, reason string) {
+	provisioningFailuresCounter.WithLabelValues(edgex.Namespace, edgex.Name, edgex.Spec.PoolName, reason).Inc()
+}
+
+// observePhase observes the duration of a phase of the reconcile started at start.
+func observePhase(phase string, start time.Time) {
+	reconcilePhaseDuration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+}
+
+func equalLabels(a, b prometheus.Labels) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func TestEdgeXMetrics(t *testing.T) {
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-metrics", Namespace: "default"},
+		Spec:       devicev1alpha2.EdgeXSpec{PoolName: "beijing", Version: "jakarta"},
+		Status: devicev1alpha2.EdgeXStatus{
+			Version:             "jakarta",
+			ReadyComponentNum:   1,
+			UnreadyComponentNum: 1,
+			Components: []devicev1alpha2.ComponentStatus{
+				{Name: "edgex-redis", Ready: true},
+				{Name: "edgex-core-data"},
+			},
+		},
+	}
+
+	recordEdgeXMetrics(edgex)
+	if ready := testutil.ToFloat64(readyComponentsGauge.With(edgexMetricLabels(edgex))); ready != 1 {
+		t.Fatalf("expected 1 ready component, got %v", ready)
+	}
+	if ready := testutil.ToFloat64(componentReadyGauge.WithLabelValues("default", "edgex-metrics", "beijing", "edgex-core-data")); ready != 0 {
+		t.Fatalf("edgex-core-data should not be ready, got %v", ready)
+	}
+
+	// the series of the former version and the dropped components are deleted
+	edgex.Status.Version = "kamakura"
+	edgex.Status.Components = edgex.Status.Components[:1]
+	recordEdgeXMetrics(edgex)
+	if count := testutil.CollectAndCount(readyComponentsGauge); count != 1 {
+		t.Fatalf("expected 1 series of ready components, got %d", count)
+	}
+	if count := testutil.CollectAndCount(componentReadyGauge); count != 1 {
+		t.Fatalf("expected 1 series of component readiness, got %d", count)
+	}
+
+	countProvisioningFailure(edgex, devicev1alpha2.ComponentProvisioningFailedReason)
+	if count := testutil.CollectAndCount(provisioningFailuresCounter); count != 1 {
+		t.Fatalf("expected 1 series of failures, got %d", count)
+	}
+
+	forgetEdgeXMetrics(edgex)
+	if count := testutil.CollectAndCount(readyComponentsGauge) + testutil.CollectAndCount(componentReadyGauge) + testutil.CollectAndCount(provisioningFailuresCounter); count != 0 {
+		t.Fatalf("the series of the deleted edgex should be deleted, got %d", count)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// generatedLists returns the lists of every kind of object generated for the edgexes.
+func generatedLists() []client.ObjectList {
+	return []client.ObjectList{
+		&unitv1alpha1.YurtAppSetList{},
+		&corev1.ServiceList{},
+		&corev1.ConfigMapList{},
+		&corev1.PersistentVolumeClaimList{},
+		&networkingv1.IngressList{},
+	}
+}
+
+// generatedFor reports whether the object is generated for the edgex.
+func generatedFor(edgex *devicev1alpha2.EdgeX, obj client.Object) bool {
+	if obj.GetLabels()[devicev1alpha2.LabelEdgeXName] == edgex.Name {
+		return true
+	}
+	for _, owner := range obj.GetOwnerReferences() {
+		if owner.UID == edgex.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// orphanResources releases the objects generated for the edgex without touching the workloads of the pool.
+// The objects shared with other edgexes only lose the owner reference, the others are unlabelled so that
+// no edgex manages them until an edgex of the same pool adopts them.
+func (r *EdgeXReconciler) orphanResources(ctx context.Context, edgex *devicev1alpha2.EdgeX) error {
+	for _, list := range generatedLists() {
+		if err := r.List(ctx, list, client.InNamespace(edgex.Namespace), client.HasLabels{devicev1alpha2.LabelEdgeXGenerate}); err != nil {
+			return err
+		}
+		if err := meta.EachListItem(list, func(o runtime.Object) error {
+			obj := o.(client.Object)
+			if !generatedFor(edgex, obj) {
+				return nil
+			}
+			removeOwnerReference(edgex, obj)
+			if len(obj.GetOwnerReferences()) == 0 {
+				labels := obj.GetLabels()
+				labels[devicev1alpha2.LabelEdgeXOrphaned] = labels[devicev1alpha2.LabelEdgeXGenerate]
+				delete(labels, devicev1alpha2.LabelEdgeXGenerate)
+				obj.SetLabels(labels)
+
+				annotations := obj.GetAnnotations()
+				if annotations == nil {
+					annotations = make(map[string]string)
+				}
+				annotations[devicev1alpha2.AnnotationOrphanedPool] = edgex.Spec.PoolName
+				annotations[devicev1alpha2.AnnotationOrphanedEdgeX] = edgex.Name
+				obj.SetAnnotations(annotations)
+			}
+			return client.IgnoreNotFound(r.Update(ctx, obj))
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// namedAfterEdgeX reports whether the objects generated with the value of LabelEdgeXGenerate
+// are named after their edgex, as opposed to the workloads shared by the edgexes.
+func namedAfterEdgeX(generate string) bool {
+	switch generate {
+	case LabelConfigmap, LabelPersistentVolumeClaim, LabelExposedService, LabelIngress:
+		return true
+	}
+	return false
+}
+
+// adoptOrphans takes over the objects orphaned by a former edgex of the same pool. The objects named
+// after the former edgex are only adopted by an edgex of the same name, which renders the same names
+// and keeps their data. The persistent volume claims are owned according to the retain policy by
+// reconcilePersistence instead.
+func (r *EdgeXReconciler) adoptOrphans(ctx context.Context, edgex *devicev1alpha2.EdgeX) error {
+	for _, list := range generatedLists() {
+		if err := r.List(ctx, list, client.InNamespace(edgex.Namespace), client.HasLabels{devicev1alpha2.LabelEdgeXOrphaned}); err != nil {
+			return err
+		}
+		if err := meta.EachListItem(list, func(o runtime.Object) error {
+			obj := o.(client.Object)
+			annotations := obj.GetAnnotations()
+			if annotations[devicev1alpha2.AnnotationOrphanedPool] != edgex.Spec.PoolName {
+				return nil
+			}
+			labels := obj.GetLabels()
+			if namedAfterEdgeX(labels[devicev1alpha2.LabelEdgeXOrphaned]) && annotations[devicev1alpha2.AnnotationOrphanedEdgeX] != edgex.Name {
+				return nil
+			}
+			delete(annotations, devicev1alpha2.AnnotationOrphanedPool)
+			delete(annotations, devicev1alpha2.AnnotationOrphanedEdgeX)
+			obj.SetAnnotations(annotations)
+
+			labels[devicev1alpha2.LabelEdgeXGenerate] = labels[devicev1alpha2.LabelEdgeXOrphaned]
+			delete(labels, devicev1alpha2.LabelEdgeXOrphaned)
+			if _, ok := labels[devicev1alpha2.LabelEdgeXName]; ok {
+				labels[devicev1alpha2.LabelEdgeXName] = edgex.Name
+			}
+			obj.SetLabels(labels)
+
+			if _, ok := obj.(*corev1.PersistentVolumeClaim); !ok {
+				if err := controllerutil.SetOwnerReference(edgex, obj, r.Scheme); err != nil {
+					return err
+				}
+			}
+			return client.IgnoreNotFound(r.Update(ctx, obj))
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markGenerated labels the object as generated, the objects orphaned by the edgexes of the other pools
+// are taken over by the edgex generating them again.
+func markGenerated(obj client.Object, value string) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[devicev1alpha2.LabelEdgeXGenerate] = value
+	delete(labels, devicev1alpha2.LabelEdgeXOrphaned)
+	obj.SetLabels(labels)
+
+	annotations := obj.GetAnnotations()
+	delete(annotations, devicev1alpha2.AnnotationOrphanedPool)
+	delete(annotations, devicev1alpha2.AnnotationOrphanedEdgeX)
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func TestOrphanAndAdopt(t *testing.T) {
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default", UID: "beijing", Finalizers: []string{devicev1alpha2.EdgexFinalizer}},
+		Spec:       devicev1alpha2.EdgeXSpec{PoolName: "beijing", DeletionPolicy: devicev1alpha2.DeletionOrphan},
+	}
+	owner := []metav1.OwnerReference{{APIVersion: devicev1alpha2.GroupVersion.String(), Kind: "EdgeX", Name: edgex.Name, UID: edgex.UID}}
+	ud := &unitv1alpha1.YurtAppSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "edgex-redis", Namespace: "default", OwnerReferences: owner,
+			Labels: map[string]string{devicev1alpha2.LabelEdgeXGenerate: LabelDeployment},
+		},
+		Spec: unitv1alpha1.YurtAppSetSpec{Topology: unitv1alpha1.Topology{Pools: []unitv1alpha1.Pool{{Name: "beijing"}}}},
+	}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name: "edgex-beijing-edgex-redis-db-data", Namespace: "default",
+		Labels: map[string]string{devicev1alpha2.LabelEdgeXGenerate: LabelPersistentVolumeClaim, devicev1alpha2.LabelEdgeXName: edgex.Name},
+	}}
+	catalog := &devicev1alpha2.VersionCatalog{ConfigMaps: []corev1.ConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Name: "common-variables"},
+		Data:       map[string]string{"EDGEX_SECURITY_SECRET_STORE": "false"},
+	}}}
+	configmap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "edgex-beijing-common-variables", Namespace: "default", OwnerReferences: owner,
+			Labels: map[string]string{devicev1alpha2.LabelEdgeXGenerate: LabelConfigmap},
+		},
+		Data: catalog.ConfigMaps[0].Data,
+	}
+	scheme := newTestScheme()
+	r := &EdgeXReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(ud, pvc, configmap).Build(), Scheme: scheme}
+
+	if _, err := r.reconcileDelete(context.TODO(), edgex); err != nil {
+		t.Fatal(err)
+	}
+	if controllerutil.ContainsFinalizer(edgex, devicev1alpha2.EdgexFinalizer) {
+		t.Fatal("the finalizer should be removed")
+	}
+	orphaned := &unitv1alpha1.YurtAppSet{}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(ud), orphaned); err != nil {
+		t.Fatal(err)
+	}
+	if len(orphaned.Spec.Topology.Pools) != 1 || len(orphaned.OwnerReferences) != 0 {
+		t.Fatalf("the pool should be kept without owners, got %v %v", orphaned.Spec.Topology.Pools, orphaned.OwnerReferences)
+	}
+	if _, ok := orphaned.Labels[devicev1alpha2.LabelEdgeXGenerate]; ok || orphaned.Labels[devicev1alpha2.LabelEdgeXOrphaned] != LabelDeployment {
+		t.Fatalf("the yurtappset should be marked as orphaned, got %v", orphaned.Labels)
+	}
+
+	// the orphans are left alone by the edgexes of the other pools
+	hangzhou := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-hangzhou", Namespace: "default", UID: "hangzhou"},
+		Spec:       devicev1alpha2.EdgeXSpec{PoolName: "hangzhou"},
+	}
+	if err := r.adoptOrphans(context.TODO(), hangzhou); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(ud), orphaned); err != nil {
+		t.Fatal(err)
+	}
+	if len(orphaned.OwnerReferences) != 0 {
+		t.Fatal("the yurtappset should not be adopted by hangzhou")
+	}
+
+	// the objects named after edgex-beijing are left to an edgex of the same name
+	renamed := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing-v2", Namespace: "default", UID: "beijing-v2"},
+		Spec:       devicev1alpha2.EdgeXSpec{PoolName: "beijing"},
+	}
+	if err := r.adoptOrphans(context.TODO(), renamed); err != nil {
+		t.Fatal(err)
+	}
+	adopted := &unitv1alpha1.YurtAppSet{}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(ud), adopted); err != nil {
+		t.Fatal(err)
+	}
+	if adopted.Labels[devicev1alpha2.LabelEdgeXGenerate] != LabelDeployment || len(adopted.OwnerReferences) != 1 || adopted.OwnerReferences[0].UID != renamed.UID {
+		t.Fatalf("the yurtappset should be adopted, got %v %v", adopted.Labels, adopted.OwnerReferences)
+	}
+	if _, err := r.reconcileConfigmap(context.TODO(), renamed, catalog, nil); err != nil {
+		t.Fatal(err)
+	}
+	orphanedConfigmap := &corev1.ConfigMap{}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(configmap), orphanedConfigmap); err != nil {
+		t.Fatalf("the orphaned configmap should be kept: %v", err)
+	}
+	if orphanedConfigmap.Labels[devicev1alpha2.LabelEdgeXOrphaned] != LabelConfigmap || len(orphanedConfigmap.OwnerReferences) != 0 {
+		t.Fatalf("the configmap should stay orphaned, got %v %v", orphanedConfigmap.Labels, orphanedConfigmap.OwnerReferences)
+	}
+	claim := &corev1.PersistentVolumeClaim{}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(pvc), claim); err != nil {
+		t.Fatal(err)
+	}
+	if claim.Labels[devicev1alpha2.LabelEdgeXOrphaned] != LabelPersistentVolumeClaim {
+		t.Fatalf("the claim should stay orphaned, got %v", claim.Labels)
+	}
+
+	// the edgex recreated with the same name renders the names of the objects it adopts
+	recreated := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default", UID: "beijing-recreated"},
+		Spec: devicev1alpha2.EdgeXSpec{
+			PoolName:    "beijing",
+			Persistence: &devicev1alpha2.Persistence{Components: []devicev1alpha2.ComponentPersistence{{Name: "edgex-redis"}}},
+		},
+	}
+	if err := r.adoptOrphans(context.TODO(), recreated); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.reconcileConfigmap(context.TODO(), recreated, catalog, nil); err != nil {
+		t.Fatal(err)
+	}
+	adoptedConfigmap := &corev1.ConfigMap{}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(configmap), adoptedConfigmap); err != nil {
+		t.Fatalf("the adopted configmap should be kept: %v", err)
+	}
+	if adoptedConfigmap.Labels[devicev1alpha2.LabelEdgeXGenerate] != LabelConfigmap || len(adoptedConfigmap.OwnerReferences) != 1 ||
+		adoptedConfigmap.OwnerReferences[0].UID != recreated.UID || adoptedConfigmap.Annotations[devicev1alpha2.AnnotationOrphanedEdgeX] != "" {
+		t.Fatalf("the configmap should be adopted, got %v %v", adoptedConfigmap.Labels, adoptedConfigmap.OwnerReferences)
+	}
+	if err := r.Get(context.TODO(), client.ObjectKeyFromObject(pvc), claim); err != nil {
+		t.Fatal(err)
+	}
+	if claim.Labels[devicev1alpha2.LabelEdgeXGenerate] != LabelPersistentVolumeClaim || claim.Labels[devicev1alpha2.LabelEdgeXName] != recreated.Name || len(claim.OwnerReferences) != 0 {
+		t.Fatalf("the claim should be labelled without owners, got %v %v", claim.Labels, claim.OwnerReferences)
+	}
+	deployment := &appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "db-data"}}}}}
+	renderPersistence(recreated, "edgex-redis", deployment)
+	if source := deployment.Template.Spec.Volumes[0].PersistentVolumeClaim; source == nil || source.ClaimName != pvc.Name {
+		t.Fatalf("the adopted claim should be mounted, got %v", deployment.Template.Spec.Volumes[0])
+	}
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// The data volumes of the stateful components in the catalog
+var persistentVolumes = map[string][]string{
+	"edgex-redis":       {"db-data"},
+	"edgex-core-consul": {"consul-data"},
+	"edgex-vault":       {"vault-file"},
+	"edgex-kong-db":     {"postgres-data"},
+}
+
+// componentPersistence returns the persistence of the component in edgex.Spec.Persistence.
+func componentPersistence(edgex *devicev1alpha2.EdgeX, name string) *devicev1alpha2.ComponentPersistence {
+	if edgex.Spec.Persistence == nil {
+		return nil
+	}
+	for i := range edgex.Spec.Persistence.Components {
+		if edgex.Spec.Persistence.Components[i].Name == name {
+			return &edgex.Spec.Persistence.Components[i]
+		}
+	}
+	return nil
+}
+
+// persistedVolumes returns the volumes of the component switched to persistent volume claims.
+func persistedVolumes(persistence *devicev1alpha2.ComponentPersistence) []string {
+	if len(persistence.Volumes) > 0 {
+		return persistence.Volumes
+	}
+	return persistentVolumes[persistence.Name]
+}
+
+func persistentVolumeClaimName(edgex *devicev1alpha2.EdgeX, component, volume string) string {
+	return edgex.Name + "-" + component + "-" + volume
+}
+
+// renderPersistence switches the volumes of the component to the persistent volume claims of the edgex.
+func renderPersistence(edgex *devicev1alpha2.EdgeX, name string, deployment *appsv1.DeploymentSpec) {
+	persistence := componentPersistence(edgex, name)
+	if persistence == nil {
+		return
+	}
+
+	persisted := false
+	for _, volumeName := range persistedVolumes(persistence) {
+		for i := range deployment.Template.Spec.Volumes {
+			volume := &deployment.Template.Spec.Volumes[i]
+			if volume.Name != volumeName {
+				continue
+			}
+			volume.VolumeSource = corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: persistentVolumeClaimName(edgex, name, volumeName),
+				},
+			}
+			persisted = true
+		}
+	}
+
+	// A new pod can not mount the claims until the old one releases them
+	if persisted {
+		deployment.Strategy = appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+	}
+}
+
+// reconcilePersistence creates the persistent volume claims of the stateful components. The claims
+// are only owned by the edgex with the Delete retain policy, so that they outlive the edgex otherwise.
+func (r *EdgeXReconciler) reconcilePersistence(ctx context.Context, edgex *devicev1alpha2.EdgeX, components []*Component) error {
+	if edgex.Spec.Persistence == nil {
+		return nil
+	}
+
+	for _, component := range components {
+		persistence := componentPersistence(edgex, component.Name)
+		if persistence == nil || component.Deployment == nil {
+			continue
+		}
+		for _, volume := range persistedVolumes(persistence) {
+			pvc := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      persistentVolumeClaimName(edgex, component.Name, volume),
+					Namespace: edgex.Namespace,
+				},
+			}
+			_, err := controllerutil.CreateOrUpdate(ctx, r.Client, pvc, func() error {
+				if pvc.Labels == nil {
+					pvc.Labels = make(map[string]string)
+				}
+				pvc.Labels[devicev1alpha2.LabelEdgeXGenerate] = LabelPersistentVolumeClaim
+				pvc.Labels[devicev1alpha2.LabelEdgeXName] = edgex.Name
+
+				if pvc.ResourceVersion == "" {
+					pvc.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+					pvc.Spec.StorageClassName = persistence.StorageClassName
+				}
+				// The claims can only be expanded
+				if current, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; !ok || persistence.Size.Cmp(current) > 0 {
+					pvc.Spec.Resources.Requests = corev1.ResourceList{corev1.ResourceStorage: persistence.Size}
+				}
+
+				if edgex.Spec.Persistence.RetainPolicy == devicev1alpha2.PersistenceDelete {
+					return controllerutil.SetOwnerReference(edgex, pvc, r.Scheme)
+				}
+				removeOwnerReference(edgex, pvc)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if edgex.Spec.Persistence.RetainPolicy == devicev1alpha2.PersistenceDelete {
+		return r.cleanupPersistence(ctx, edgex)
+	}
+	return nil
+}
+
+// cleanupPersistence deletes the claims owned by the edgex which no longer match an entry of
+// edgex.Spec.Persistence, the claims retained before are not owned and so are left alone.
+func (r *EdgeXReconciler) cleanupPersistence(ctx context.Context, edgex *devicev1alpha2.EdgeX) error {
+	claimed := make(map[string]struct{})
+	for i := range edgex.Spec.Persistence.Components {
+		persistence := &edgex.Spec.Persistence.Components[i]
+		for _, volume := range persistedVolumes(persistence) {
+			claimed[persistentVolumeClaimName(edgex, persistence.Name, volume)] = struct{}{}
+		}
+	}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, pvcs, client.InNamespace(edgex.Namespace), client.MatchingLabels{
+		devicev1alpha2.LabelEdgeXGenerate: LabelPersistentVolumeClaim,
+		devicev1alpha2.LabelEdgeXName:     edgex.Name,
+	}); err != nil {
+		return err
+	}
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		if _, ok := claimed[pvc.Name]; ok || !ownedBy(edgex, pvc) {
+			continue
+		}
+		if err := r.Delete(ctx, pvc); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ownedBy reports whether the edgex is one of the owners of the object.
+func ownedBy(edgex *devicev1alpha2.EdgeX, obj client.Object) bool {
+	for _, owner := range obj.GetOwnerReferences() {
+		if owner.UID == edgex.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// removeOwnerReference removes the edgex from the owners of the object without updating it.
+func removeOwnerReference(edgex *devicev1alpha2.EdgeX, obj client.Object) {
+	owners := obj.GetOwnerReferences()
+	for i, owner := range owners {
+		if owner.UID == edgex.UID {
+			obj.SetOwnerReferences(append(owners[:i], owners[i+1:]...))
+			return
+		}
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func TestRenderPersistence(t *testing.T) {
+	component := testComponent("edgex-redis", "redis:6.2.6-alpine")
+	component.Deployment.Template.Spec.Volumes = []corev1.Volume{
+		{Name: "db-data", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		{Name: "redis-config", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+	}
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing"},
+		Spec: devicev1alpha2.EdgeXSpec{
+			PoolName: "beijing",
+			Persistence: &devicev1alpha2.Persistence{
+				Components: []devicev1alpha2.ComponentPersistence{{Name: "edgex-redis", Size: resource.MustParse("1Gi")}},
+			},
+		},
+	}
+
+	pool, err := desiredPool(edgex, component.Deployment, renderDeployment(edgex, nil, component))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment := applyPool(t, component.Deployment, pool)
+	volumes := deployment.Template.Spec.Volumes
+	if volumes[0].EmptyDir != nil || volumes[0].PersistentVolumeClaim == nil || volumes[0].PersistentVolumeClaim.ClaimName != "edgex-beijing-edgex-redis-db-data" {
+		t.Fatalf("the data volume should be switched to the claim, got %+v", volumes[0].VolumeSource)
+	}
+	if volumes[1].EmptyDir == nil {
+		t.Fatalf("the other volumes should be kept, got %+v", volumes[1].VolumeSource)
+	}
+	if deployment.Strategy.Type != appsv1.RecreateDeploymentStrategyType {
+		t.Fatalf("unexpected strategy %s", deployment.Strategy.Type)
+	}
+}
+
+func TestReconcilePersistence(t *testing.T) {
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default", UID: "beijing"},
+		Spec: devicev1alpha2.EdgeXSpec{
+			Persistence: &devicev1alpha2.Persistence{
+				Components: []devicev1alpha2.ComponentPersistence{{Name: "edgex-redis", Size: resource.MustParse("1Gi")}},
+			},
+		},
+	}
+	components := []*Component{testComponent("edgex-redis", "redis:6.2.6-alpine"), testComponent("edgex-core-data", "core-data")}
+
+	scheme := newTestScheme()
+	r := &EdgeXReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme}
+	if err := r.reconcilePersistence(context.TODO(), edgex, components); err != nil {
+		t.Fatal(err)
+	}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(context.TODO(), pvcs); err != nil {
+		t.Fatal(err)
+	}
+	if len(pvcs.Items) != 1 {
+		t.Fatalf("expected one claim, got %d", len(pvcs.Items))
+	}
+	pvc := &pvcs.Items[0]
+	if pvc.Name != "edgex-beijing-edgex-redis-db-data" || len(pvc.OwnerReferences) != 0 {
+		t.Fatalf("the claim should be retained by default, got %s owned by %v", pvc.Name, pvc.OwnerReferences)
+	}
+
+	// the claims are owned by the edgex to be deleted with it, and never shrunk
+	edgex.Spec.Persistence.RetainPolicy = devicev1alpha2.PersistenceDelete
+	edgex.Spec.Persistence.Components[0].Size = resource.MustParse("512Mi")
+	if err := r.reconcilePersistence(context.TODO(), edgex, components); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: pvc.Name}, pvc); err != nil {
+		t.Fatal(err)
+	}
+	if len(pvc.OwnerReferences) != 1 || pvc.OwnerReferences[0].UID != edgex.UID {
+		t.Fatalf("the claim should be owned by the edgex, got %v", pvc.OwnerReferences)
+	}
+	if size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; size.String() != "1Gi" {
+		t.Fatalf("the claim should not be shrunk, got %s", size.String())
+	}
+
+	// the owned claims without an entry any more are deleted, the retained ones are left alone
+	retained := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name:      "edgex-beijing-edgex-core-consul-consul-data",
+		Namespace: "default",
+		Labels:    map[string]string{devicev1alpha2.LabelEdgeXGenerate: LabelPersistentVolumeClaim, devicev1alpha2.LabelEdgeXName: edgex.Name},
+	}}
+	if err := r.Create(context.TODO(), retained); err != nil {
+		t.Fatal(err)
+	}
+	edgex.Spec.Persistence.Components[0].Name = "edgex-core-data"
+	edgex.Spec.Persistence.Components[0].Volumes = []string{"data"}
+	if err := r.reconcilePersistence(context.TODO(), edgex, components); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: pvc.Name}, pvc); !apierrors.IsNotFound(err) {
+		t.Fatalf("the claim of edgex-redis should be deleted, got %v", err)
+	}
+	for _, name := range []string{retained.Name, "edgex-beijing-edgex-core-data-data"} {
+		if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: name}, &corev1.PersistentVolumeClaim{}); err != nil {
+			t.Fatalf("the claim %s should be kept, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/utils/pointer"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// specComponent returns the component of edgex.Spec.Components with the given name.
+func specComponent(edgex *devicev1alpha2.EdgeX, name string) *devicev1alpha2.Component {
+	for i := range edgex.Spec.Components {
+		if edgex.Spec.Components[i].Name == name {
+			return &edgex.Spec.Components[i]
+		}
+	}
+	return nil
+}
+
+// edgexConfigMapName returns the name of the configmap rendered for the edgex from the catalog configmap.
+func edgexConfigMapName(edgex *devicev1alpha2.EdgeX, name string) string {
+	return edgex.Name + "-" + name
+}
+
+// renderDeployment renders the deployment of the component as the edgex wants it,
+// the deployment of the version catalog is never modified.
+func renderDeployment(edgex *devicev1alpha2.EdgeX, catalog *devicev1alpha2.VersionCatalog, component *Component) *appsv1.DeploymentSpec {
+	deployment := component.Deployment.DeepCopy()
+
+	if catalog != nil {
+		renderConfigMapRefs(edgex, catalog, &deployment.Template.Spec)
+	}
+
+	if edgex.Spec.ImageRegistry != "" {
+		podSpec := &deployment.Template.Spec
+		for i := range podSpec.InitContainers {
+			podSpec.InitContainers[i].Image = rewriteImageRegistry(podSpec.InitContainers[i].Image, edgex.Spec.ImageRegistry)
+		}
+		for i := range podSpec.Containers {
+			podSpec.Containers[i].Image = rewriteImageRegistry(podSpec.Containers[i].Image, edgex.Spec.ImageRegistry)
+		}
+	}
+
+	if c := specComponent(edgex, component.Name); c != nil {
+		renderComponent(edgex, c, component.Name, deployment)
+	}
+	renderPersistence(edgex, component.Name, deployment)
+
+	// The exposed service of the component selects the pods of the edgex by its name. core-metadata
+	// is labelled anyway, so that exposing it to sync the device inventory does not roll its pods.
+	if component.Service != nil && (componentExpose(edgex, component) != nil || component.Name == MetadataComponent) {
+		if deployment.Template.Labels == nil {
+			deployment.Template.Labels = make(map[string]string)
+		}
+		deployment.Template.Labels[devicev1alpha2.LabelEdgeXName] = edgex.Name
+	}
+
+	// The pods read the common variables only when they start
+	if len(edgex.Spec.Env) > 0 {
+		if deployment.Template.Annotations == nil {
+			deployment.Template.Annotations = make(map[string]string)
+		}
+		deployment.Template.Annotations[AnnotationEnvChecksum] = envChecksum(edgex.Spec.Env)
+	}
+
+	return deployment
+}
+
+// renderComponent renders the settings of the component in edgex.Spec.Components into the deployment.
+func renderComponent(edgex *devicev1alpha2.EdgeX, c *devicev1alpha2.Component, name string, deployment *appsv1.DeploymentSpec) {
+	podSpec := &deployment.Template.Spec
+
+	if container := mainContainer(podSpec, name); container != nil {
+		// The image set explicitly by the user is taken as it is
+		if c.Image != "" {
+			container.Image = c.Image
+		}
+		container.Env = mergeEnvVars(container.Env, c.Env)
+		if c.Resources != nil {
+			container.Resources = *c.Resources.DeepCopy()
+		}
+	}
+
+	if c.Replicas != nil {
+		deployment.Replicas = pointer.Int32Ptr(*c.Replicas)
+	}
+	if len(c.NodeSelector) > 0 {
+		if podSpec.NodeSelector == nil {
+			podSpec.NodeSelector = make(map[string]string, len(c.NodeSelector))
+		}
+		for k, v := range c.NodeSelector {
+			podSpec.NodeSelector[k] = v
+		}
+	}
+	podSpec.Tolerations = append(podSpec.Tolerations, c.Tolerations...)
+	if c.Affinity != nil {
+		podSpec.Affinity = poolAffinity(edgex, c.Affinity)
+	}
+}
+
+// poolAffinity returns a copy of the affinity whose required node terms all keep the pods in the pool,
+// since the affinity of the pool patch replaces the node selector term of the pool.
+func poolAffinity(edgex *devicev1alpha2.EdgeX, affinity *corev1.Affinity) *corev1.Affinity {
+	affinity = affinity.DeepCopy()
+	if affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return affinity
+	}
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for i := range terms {
+		terms[i].MatchExpressions = append(terms[i].MatchExpressions, poolRequirement(edgex))
+	}
+	return affinity
+}
+
+func poolRequirement(edgex *devicev1alpha2.EdgeX) corev1.NodeSelectorRequirement {
+	return corev1.NodeSelectorRequirement{
+		Key:      unitv1alpha1.LabelCurrentNodePool,
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{edgex.Spec.PoolName},
+	}
+}
+
+// renderConfigMapRefs points the references to the catalog configmaps at the ones rendered for the edgex.
+func renderConfigMapRefs(edgex *devicev1alpha2.EdgeX, catalog *devicev1alpha2.VersionCatalog, podSpec *corev1.PodSpec) {
+	catalogConfigMaps := make(map[string]struct{}, len(catalog.ConfigMaps))
+	for _, configmap := range catalog.ConfigMaps {
+		catalogConfigMaps[configmap.Name] = struct{}{}
+	}
+	rename := func(name *string) {
+		if _, ok := catalogConfigMaps[*name]; ok {
+			*name = edgexConfigMapName(edgex, *name)
+		}
+	}
+
+	containers := append(podSpec.InitContainers[:len(podSpec.InitContainers):len(podSpec.InitContainers)], podSpec.Containers...)
+	for _, container := range containers {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				rename(&envFrom.ConfigMapRef.Name)
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.ConfigMapKeyRef != nil {
+				rename(&env.ValueFrom.ConfigMapKeyRef.Name)
+			}
+		}
+	}
+	for _, volume := range podSpec.Volumes {
+		if volume.ConfigMap != nil {
+			rename(&volume.ConfigMap.Name)
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					rename(&source.ConfigMap.Name)
+				}
+			}
+		}
+	}
+}
+
+// mergeEnv returns the data of a configmap with the plain values of the env merged over it.
+func mergeEnv(data map[string]string, env []corev1.EnvVar) map[string]string {
+	merged := make(map[string]string, len(data)+len(env))
+	for k, v := range data {
+		merged[k] = v
+	}
+	for _, e := range env {
+		if e.ValueFrom == nil {
+			merged[e.Name] = e.Value
+		}
+	}
+	return merged
+}
+
+// mergeEnvVars merges the overrides over the environment variables of a container,
+// a variable with the same name is replaced in place and the others are appended.
+func mergeEnvVars(env, overrides []corev1.EnvVar) []corev1.EnvVar {
+	for _, override := range overrides {
+		replaced := false
+		for i := range env {
+			if env[i].Name == override.Name {
+				env[i] = override
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			env = append(env, override)
+		}
+	}
+	return env
+}
+
+func envChecksum(env []corev1.EnvVar) string {
+	content, _ := json.Marshal(env)
+	return fmt.Sprintf("%x", sha256.Sum256(content))
+}
+
+// rewriteImageRegistry replaces the registry of the image with the given one,
+// the repository path and the tag or digest of the image are preserved.
+func rewriteImageRegistry(image, registry string) string {
+	registry = strings.TrimSuffix(registry, "/")
+	if image == "" || registry == "" {
+		return image
+	}
+
+	// Same as docker, the first part of the name is a registry only when
+	// it looks like a host, otherwise the image lives in the default registry.
+	if i := strings.IndexRune(image, '/'); i > 0 {
+		domain := image[:i]
+		if strings.ContainsAny(domain, ".:") || domain == "localhost" {
+			image = image[i+1:]
+		}
+	}
+	return registry + "/" + image
+}
+
+// mainContainer returns the container named after the component,
+// or the first container if there is no such one.
+func mainContainer(podSpec *corev1.PodSpec, name string) *corev1.Container {
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == name {
+			return &podSpec.Containers[i]
+		}
+	}
+	if len(podSpec.Containers) > 0 {
+		return &podSpec.Containers[0]
+	}
+	return nil
+}
+
+// desiredPool renders the pool of the edgex in a yurtappset. The yurtappset template is shared by
+// every pool in the namespace, so the difference between the template and the deployment rendered
+// for the edgex is carried by the pool patch and only rolls the deployment of this pool.
+func desiredPool(edgex *devicev1alpha2.EdgeX, template, desired *appsv1.DeploymentSpec) (unitv1alpha1.Pool, error) {
+	pool := unitv1alpha1.Pool{
+		Name:     edgex.Spec.PoolName,
+		Replicas: pointer.Int32Ptr(1),
+	}
+	pool.NodeSelectorTerm.MatchExpressions = append(pool.NodeSelectorTerm.MatchExpressions, poolRequirement(edgex))
+
+	// The replicas are carried by the pool rather than the patch
+	if desired.Replicas != nil {
+		pool.Replicas = pointer.Int32Ptr(*desired.Replicas)
+		desired = desired.DeepCopy()
+		desired.Replicas = template.Replicas
+	}
+
+	patch, err := deploymentPatch(template, desired)
+	if err != nil {
+		return pool, err
+	}
+	if patch != nil {
+		pool.Patch = &runtime.RawExtension{Raw: patch}
+	}
+	return pool, nil
+}
+
+// deploymentPatch creates the strategic merge patch which turns a deployment with the template spec
+// into one with the desired spec, it returns nil when there is nothing to patch.
+func deploymentPatch(template, desired *appsv1.DeploymentSpec) ([]byte, error) {
+	original, err := json.Marshal(&appsv1.Deployment{Spec: *template})
+	if err != nil {
+		return nil, err
+	}
+	modified, err := json.Marshal(&appsv1.Deployment{Spec: *desired})
+	if err != nil {
+		return nil, err
+	}
+	patch, err := strategicpatch.CreateTwoWayMergePatch(original, modified, &appsv1.Deployment{})
+	if err != nil {
+		return nil, err
+	}
+	if string(patch) == "{}" {
+		return nil, nil
+	}
+	return patch, nil
+}
+
+// poolEqual compares two pools, the patches are compared by their content rather than their bytes.
+func poolEqual(a, b unitv1alpha1.Pool) bool {
+	if a.Name != b.Name ||
+		!apiequality.Semantic.DeepEqual(a.Replicas, b.Replicas) ||
+		!apiequality.Semantic.DeepEqual(a.NodeSelectorTerm, b.NodeSelectorTerm) ||
+		!apiequality.Semantic.DeepEqual(a.Tolerations, b.Tolerations) {
+		return false
+	}
+	return rawEqual(a.Patch, b.Patch)
+}
+
+// templateHash returns the hash of the deployment template as it is applied to a yurtappset.
+func templateHash(template *appsv1.DeploymentSpec) string {
+	content, _ := json.Marshal(template)
+	return fmt.Sprintf("%x", sha256.Sum256(content))
+}
+
+// templateApplied reports whether the template of the yurtappset is the desired one. The live template is
+// filled with the defaults by the api server and the webhooks, so the desired template is compared with the
+// hash of the one last applied, and the live template only has to keep all the fields the desired one sets.
+func templateApplied(ud *unitv1alpha1.YurtAppSet, desired *appsv1.DeploymentSpec) bool {
+	if ud.Annotations[AnnotationTemplateHash] != templateHash(desired) {
+		return false
+	}
+	liveRaw, err := json.Marshal(&ud.Spec.WorkloadTemplate.DeploymentTemplate.Spec)
+	if err != nil {
+		return false
+	}
+	desiredRaw, err := json.Marshal(desired)
+	if err != nil {
+		return false
+	}
+	var live, want interface{}
+	if err := json.Unmarshal(liveRaw, &live); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(desiredRaw, &want); err != nil {
+		return false
+	}
+	return containsValue(live, want)
+}
+
+// containsValue reports whether the fields set in want are all set to the same values in live,
+// the lists must have the same length and their items are compared in order.
+func containsValue(live, want interface{}) bool {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range w {
+			if !containsValue(l[k], v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !containsValue(l[i], w[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return apiequality.Semantic.DeepEqual(live, want)
+}
+
+func rawEqual(a, b *runtime.RawExtension) bool {
+	if a == nil || len(a.Raw) == 0 || b == nil || len(b.Raw) == 0 {
+		return (a == nil || len(a.Raw) == 0) && (b == nil || len(b.Raw) == 0)
+	}
+	var av, bv interface{}
+	if err := json.Unmarshal(a.Raw, &av); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(b.Raw, &bv); err != nil {
+		return false
+	}
+	return apiequality.Semantic.DeepEqual(av, bv)
+}
+
+// findPool returns the index of the pool in the yurtappset topology, -1 if it is not found.
+func findPool(ud *unitv1alpha1.YurtAppSet, poolName string) int {
+	for i, pool := range ud.Spec.Topology.Pools {
+		if pool.Name == poolName {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,295 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"testing"
+
+	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/utils/pointer"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func testComponent(name, image string) *Component {
+	return &Component{
+		Name: name,
+		Deployment: &appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": name}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:  name,
+						Image: image,
+						EnvFrom: []corev1.EnvFromSource{{
+							ConfigMapRef: &corev1.ConfigMapEnvSource{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "common-variable-levski"},
+							},
+						}},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// applyPool returns the deployment spec the yurtappset renders for the pool.
+func applyPool(t *testing.T, template *appsv1.DeploymentSpec, pool unitv1alpha1.Pool) *appsv1.DeploymentSpec {
+	t.Helper()
+	original, err := json.Marshal(&appsv1.Deployment{Spec: *template})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Patch == nil {
+		return template
+	}
+	patched, err := strategicpatch.StrategicMergePatch(original, pool.Patch.Raw, &appsv1.Deployment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := json.Unmarshal(patched, deployment); err != nil {
+		t.Fatal(err)
+	}
+	return &deployment.Spec
+}
+
+func TestDesiredPoolImageOverride(t *testing.T) {
+	component := testComponent("edgex-core-data", "openyurt/core-data:2.3.0")
+	edgex := &devicev1alpha2.EdgeX{
+		Spec: devicev1alpha2.EdgeXSpec{
+			PoolName: "beijing",
+		},
+	}
+
+	pool, err := desiredPool(edgex, component.Deployment, renderDeployment(edgex, nil, component))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Patch != nil {
+		t.Fatalf("pool should not be patched without customization, got %s", pool.Patch.Raw)
+	}
+
+	edgex.Spec.Components = []devicev1alpha2.Component{{Name: "edgex-core-data", Image: "myrepo/core-data:2.3.1-patched"}}
+	pool, err = desiredPool(edgex, component.Deployment, renderDeployment(edgex, nil, component))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Patch == nil {
+		t.Fatal("pool should be patched with the image override")
+	}
+	deployment := applyPool(t, component.Deployment, pool)
+	if image := deployment.Template.Spec.Containers[0].Image; image != "myrepo/core-data:2.3.1-patched" {
+		t.Fatalf("unexpected image %s", image)
+	}
+	if image := component.Deployment.Template.Spec.Containers[0].Image; image != "openyurt/core-data:2.3.0" {
+		t.Fatalf("the catalog should not be modified, got image %s", image)
+	}
+}
+
+func TestPoolEqual(t *testing.T) {
+	a := unitv1alpha1.Pool{
+		Name:  "beijing",
+		Patch: &runtime.RawExtension{Raw: []byte(`{"spec":{"replicas":1,"paused":true}}`)},
+	}
+	b := unitv1alpha1.Pool{
+		Name:  "beijing",
+		Patch: &runtime.RawExtension{Raw: []byte(`{"spec": {"paused": true, "replicas": 1}}`)},
+	}
+	if !poolEqual(a, b) {
+		t.Fatal("pools with the same patch content should be equal")
+	}
+
+	b.Patch = nil
+	if poolEqual(a, b) {
+		t.Fatal("pools with and without patch should not be equal")
+	}
+}
+
+func TestRewriteImageRegistry(t *testing.T) {
+	cases := []struct {
+		image    string
+		registry string
+		expected string
+	}{
+		{"openyurt/core-data:2.3.0", "registry.local:5000", "registry.local:5000/openyurt/core-data:2.3.0"},
+		{"redis:6.2.6-alpine", "registry.local/", "registry.local/redis:6.2.6-alpine"},
+		{"docker.io/library/redis:6.2", "mirror.example.com/edgex", "mirror.example.com/edgex/library/redis:6.2"},
+		{"localhost/kong@sha256:1234", "mirror.example.com", "mirror.example.com/kong@sha256:1234"},
+		{"registry.local:5000/openyurt/core-data:2.3.0", "registry.local:5000", "registry.local:5000/openyurt/core-data:2.3.0"},
+		{"openyurt/core-data:2.3.0", "", "openyurt/core-data:2.3.0"},
+	}
+	for _, c := range cases {
+		if got := rewriteImageRegistry(c.image, c.registry); got != c.expected {
+			t.Errorf("rewrite %s to %s: expected %s, got %s", c.image, c.registry, c.expected, got)
+		}
+	}
+}
+
+func TestRenderDeploymentImageRegistry(t *testing.T) {
+	component := testComponent("edgex-core-data", "openyurt/core-data:2.3.0")
+	component.Deployment.Template.Spec.InitContainers = []corev1.Container{{Name: "init", Image: "busybox:1.35"}}
+	edgex := &devicev1alpha2.EdgeX{
+		Spec: devicev1alpha2.EdgeXSpec{
+			PoolName:      "beijing",
+			ImageRegistry: "registry.local:5000",
+		},
+	}
+
+	deployment := renderDeployment(edgex, nil, component)
+	if image := deployment.Template.Spec.Containers[0].Image; image != "registry.local:5000/openyurt/core-data:2.3.0" {
+		t.Fatalf("unexpected container image %s", image)
+	}
+	if image := deployment.Template.Spec.InitContainers[0].Image; image != "registry.local:5000/busybox:1.35" {
+		t.Fatalf("unexpected init container image %s", image)
+	}
+
+	// the image override of the component wins over the registry
+	edgex.Spec.Components = []devicev1alpha2.Component{{Name: "edgex-core-data", Image: "myrepo/core-data:2.3.1-patched"}}
+	deployment = renderDeployment(edgex, nil, component)
+	if image := deployment.Template.Spec.Containers[0].Image; image != "myrepo/core-data:2.3.1-patched" {
+		t.Fatalf("unexpected container image %s", image)
+	}
+}
+
+func TestRenderDeploymentConfigMaps(t *testing.T) {
+	component := testComponent("edgex-core-data", "openyurt/core-data:2.3.0")
+	podSpec := &component.Deployment.Template.Spec
+	podSpec.Volumes = []corev1.Volume{
+		{Name: "catalog", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "common-variable-levski"},
+		}}},
+		{Name: "user", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "user-config"},
+		}}},
+	}
+	catalog := &devicev1alpha2.VersionCatalog{
+		ConfigMaps: []corev1.ConfigMap{{ObjectMeta: metav1.ObjectMeta{Name: "common-variable-levski"}}},
+	}
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing"},
+		Spec:       devicev1alpha2.EdgeXSpec{PoolName: "beijing"},
+	}
+
+	deployment := renderDeployment(edgex, catalog, component)
+	if name := deployment.Template.Spec.Containers[0].EnvFrom[0].ConfigMapRef.Name; name != "edgex-beijing-common-variable-levski" {
+		t.Fatalf("unexpected envFrom configmap %s", name)
+	}
+	if name := deployment.Template.Spec.Volumes[0].ConfigMap.Name; name != "edgex-beijing-common-variable-levski" {
+		t.Fatalf("unexpected volume configmap %s", name)
+	}
+	if name := deployment.Template.Spec.Volumes[1].ConfigMap.Name; name != "user-config" {
+		t.Fatalf("the configmaps out of the catalog should be kept, got %s", name)
+	}
+	if name := podSpec.Containers[0].EnvFrom[0].ConfigMapRef.Name; name != "common-variable-levski" {
+		t.Fatalf("the catalog should not be modified, got %s", name)
+	}
+}
+
+func TestRenderDeploymentEnv(t *testing.T) {
+	component := testComponent("edgex-core-data", "openyurt/core-data:2.3.0")
+	component.Deployment.Template.Spec.Containers[0].Env = []corev1.EnvVar{{Name: "SERVICE_HOST", Value: "edgex-core-data"}}
+	edgex := &devicev1alpha2.EdgeX{
+		Spec: devicev1alpha2.EdgeXSpec{
+			PoolName: "beijing",
+			Components: []devicev1alpha2.Component{{
+				Name: "edgex-core-data",
+				Env: []corev1.EnvVar{
+					{Name: "SERVICE_HOST", Value: "edgex-core-data-beijing"},
+					{Name: "WRITABLE_LOGLEVEL", Value: "DEBUG"},
+				},
+			}},
+		},
+	}
+
+	deployment := renderDeployment(edgex, nil, component)
+	env := deployment.Template.Spec.Containers[0].Env
+	if len(env) != 2 || env[0].Value != "edgex-core-data-beijing" || env[1].Name != "WRITABLE_LOGLEVEL" {
+		t.Fatalf("unexpected env %v", env)
+	}
+	if _, ok := deployment.Template.Annotations[AnnotationEnvChecksum]; ok {
+		t.Fatal("the pods should not be annotated without the global env")
+	}
+
+	// the pods are rolled when the global env changes
+	edgex.Spec.Env = []corev1.EnvVar{{Name: "STAGEGATE_WAITFOR_TIMEOUT", Value: "120s"}}
+	checksum := renderDeployment(edgex, nil, component).Template.Annotations[AnnotationEnvChecksum]
+	edgex.Spec.Env[0].Value = "180s"
+	if checksum == "" || checksum == renderDeployment(edgex, nil, component).Template.Annotations[AnnotationEnvChecksum] {
+		t.Fatalf("the checksum should change with the env, got %q", checksum)
+	}
+}
+
+func TestDesiredPoolComponentSettings(t *testing.T) {
+	component := testComponent("edgex-redis", "redis:6.2.6-alpine")
+	edgex := &devicev1alpha2.EdgeX{
+		Spec: devicev1alpha2.EdgeXSpec{
+			PoolName: "beijing",
+			Components: []devicev1alpha2.Component{{
+				Name:     "edgex-redis",
+				Replicas: pointer.Int32Ptr(2),
+				Resources: &corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+				},
+				NodeSelector: map[string]string{"disk": "ssd"},
+				Tolerations:  []corev1.Toleration{{Key: "edge", Operator: corev1.TolerationOpExists}},
+				Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{
+							{Key: "kubernetes.io/arch", Operator: corev1.NodeSelectorOpIn, Values: []string{"arm64"}},
+						}}},
+					},
+				}},
+			}},
+		},
+	}
+
+	pool, err := desiredPool(edgex, component.Deployment, renderDeployment(edgex, nil, component))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *pool.Replicas != 2 {
+		t.Fatalf("unexpected replicas %d", *pool.Replicas)
+	}
+
+	deployment := applyPool(t, component.Deployment, pool)
+	if deployment.Replicas != nil {
+		t.Fatalf("the replicas should be carried by the pool rather than the patch, got %d", *deployment.Replicas)
+	}
+	podSpec := deployment.Template.Spec
+	if memory := podSpec.Containers[0].Resources.Limits[corev1.ResourceMemory]; memory.String() != "64Mi" {
+		t.Fatalf("unexpected memory limit %s", memory.String())
+	}
+	if podSpec.NodeSelector["disk"] != "ssd" || len(podSpec.Tolerations) != 1 {
+		t.Fatalf("unexpected scheduling %v %v", podSpec.NodeSelector, podSpec.Tolerations)
+	}
+	expressions := podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions
+	if len(expressions) != 2 || expressions[1].Key != unitv1alpha1.LabelCurrentNodePool || expressions[1].Values[0] != "beijing" {
+		t.Fatalf("the affinity should keep the pods in the pool, got %v", expressions)
+	}
+	if component.Deployment.Template.Spec.Affinity != nil || len(edgex.Spec.Components[0].Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions) != 1 {
+		t.Fatal("neither the catalog nor the spec should be modified")
+	}
+}
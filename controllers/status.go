@@ -0,0 +1,117 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// apiReader returns the reader of the objects which are not cached by the manager.
+func (r *EdgeXReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// poolDeployment returns the deployment the yurtappset provisions for the pool,
+// nil if it is not provisioned yet.
+func (r *EdgeXReconciler) poolDeployment(ctx context.Context, ud *unitv1alpha1.YurtAppSet, poolName string) (*appsv1.Deployment, error) {
+	deployments := &appsv1.DeploymentList{}
+	if err := r.apiReader().List(ctx, deployments, client.InNamespace(ud.Namespace), client.MatchingLabels{unitv1alpha1.PoolNameLabelKey: poolName}); err != nil {
+		return nil, err
+	}
+	for i := range deployments.Items {
+		if metav1.IsControlledBy(&deployments.Items[i], ud) {
+			return &deployments.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// poolPodsRunning reports whether any pod of the yurtappset is still running in the pool.
+func (r *EdgeXReconciler) poolPodsRunning(ctx context.Context, ud *unitv1alpha1.YurtAppSet, poolName string) (bool, error) {
+	selector, err := metav1.LabelSelectorAsSelector(ud.Spec.Selector)
+	if err != nil {
+		return false, err
+	}
+	requirement, err := labels.NewRequirement(unitv1alpha1.PoolNameLabelKey, selection.Equals, []string{poolName})
+	if err != nil {
+		return false, err
+	}
+	pods := &corev1.PodList{}
+	if err := r.apiReader().List(ctx, pods, client.InNamespace(ud.Namespace), client.MatchingLabelsSelector{Selector: selector.Add(*requirement)}); err != nil {
+		return false, err
+	}
+	return len(pods.Items) > 0, nil
+}
+
+// poolReady reports whether the pool of the yurtappset is ready, and returns the deployment provisioned
+// for the pool. The status of the yurtappset aggregates every pool, so only that deployment is looked at.
+func (r *EdgeXReconciler) poolReady(ctx context.Context, ud *unitv1alpha1.YurtAppSet, poolName string) (bool, *appsv1.Deployment, error) {
+	if _, ok := ud.Status.PoolReplicas[poolName]; !ok {
+		return false, nil, nil
+	}
+	deployment, err := r.poolDeployment(ctx, ud, poolName)
+	if err != nil || deployment == nil {
+		return false, nil, err
+	}
+	return deploymentReady(deployment), deployment, nil
+}
+
+// deploymentReady reports whether the latest spec of the deployment is rolled out
+// and all of its replicas are ready.
+func deploymentReady(deployment *appsv1.Deployment) bool {
+	var replicas int32 = 1
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	return status.ObservedGeneration >= deployment.Generation &&
+		status.UpdatedReplicas == replicas &&
+		status.Replicas == replicas &&
+		status.ReadyReplicas >= replicas
+}
+
+// updateComponentStatus returns the latest status of the components, the last transition time
+// is carried over from the previous status unless the readiness of the component changed.
+func updateComponentStatus(previous, latest []devicev1alpha2.ComponentStatus) []devicev1alpha2.ComponentStatus {
+	previousStatus := make(map[string]devicev1alpha2.ComponentStatus, len(previous))
+	for _, status := range previous {
+		previousStatus[status.Name] = status
+	}
+
+	now := metav1.Now()
+	for i := range latest {
+		if status, ok := previousStatus[latest[i].Name]; ok && status.Ready == latest[i].Ready {
+			latest[i].LastTransitionTime = status.LastTransitionTime
+		} else {
+			latest[i].LastTransitionTime = now
+		}
+	}
+	return latest
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func newTestScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = devicev1alpha2.AddToScheme(scheme)
+	_ = unitv1alpha1.AddToScheme(scheme)
+	return scheme
+}
+
+func poolDeploymentFor(ud *unitv1alpha1.YurtAppSet, poolName string, ready int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ud.Name + "-" + poolName,
+			Namespace: ud.Namespace,
+			Labels:    map[string]string{unitv1alpha1.PoolNameLabelKey: poolName},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: unitv1alpha1.GroupVersion.String(),
+				Kind:       "YurtAppSet",
+				Name:       ud.Name,
+				UID:        ud.UID,
+				Controller: pointer.BoolPtr(true),
+			}},
+		},
+		Spec: appsv1.DeploymentSpec{Replicas: pointer.Int32Ptr(1)},
+		Status: appsv1.DeploymentStatus{
+			Replicas:        1,
+			UpdatedReplicas: 1,
+			ReadyReplicas:   ready,
+		},
+	}
+}
+
+func TestPoolReady(t *testing.T) {
+	ud := &unitv1alpha1.YurtAppSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-core-data", Namespace: "default", UID: "yas-uid"},
+		Status: unitv1alpha1.YurtAppSetStatus{
+			// the aggregated status looks unready because of the hangzhou pool
+			Replicas:      2,
+			ReadyReplicas: 1,
+			PoolReplicas:  map[string]int32{"beijing": 1, "hangzhou": 1},
+		},
+	}
+	objs := []client.Object{
+		poolDeploymentFor(ud, "beijing", 1),
+		poolDeploymentFor(ud, "hangzhou", 0),
+	}
+	// the deployments are read from the api server rather than the cache of the manager
+	r := &EdgeXReconciler{
+		Client:    fake.NewClientBuilder().WithScheme(newTestScheme()).Build(),
+		APIReader: fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(objs...).Build(),
+	}
+
+	cases := map[string]bool{"beijing": true, "hangzhou": false, "shanghai": false}
+	for pool, expected := range cases {
+		ready, _, err := r.poolReady(context.TODO(), ud, pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ready != expected {
+			t.Errorf("pool %s: expected ready %v, got %v", pool, expected, ready)
+		}
+	}
+}
+
+func TestPoolPodsRunning(t *testing.T) {
+	ud := &unitv1alpha1.YurtAppSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-core-data", Namespace: "default"},
+		Spec:       unitv1alpha1.YurtAppSetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "edgex-core-data"}}},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "edgex-core-data-beijing-0",
+		Namespace: "default",
+		Labels:    map[string]string{"app": "edgex-core-data", unitv1alpha1.PoolNameLabelKey: "beijing"},
+	}}
+	// the pods are read from the api server rather than the cache of the manager
+	r := &EdgeXReconciler{
+		Client:    fake.NewClientBuilder().WithScheme(newTestScheme()).Build(),
+		APIReader: fake.NewClientBuilder().WithScheme(newTestScheme()).WithObjects(pod).Build(),
+	}
+
+	cases := map[string]bool{"beijing": true, "hangzhou": false}
+	for pool, expected := range cases {
+		running, err := r.poolPodsRunning(context.TODO(), ud, pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if running != expected {
+			t.Errorf("pool %s: expected running %v, got %v", pool, expected, running)
+		}
+	}
+}
+
+func TestDeploymentReady(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: pointer.Int32Ptr(1)},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 2,
+			Replicas:           2,
+			UpdatedReplicas:    1,
+			ReadyReplicas:      2,
+		},
+	}
+	if deploymentReady(deployment) {
+		t.Fatal("deployment with old replicas still running should not be ready")
+	}
+
+	deployment.Status.Replicas = 1
+	if !deploymentReady(deployment) {
+		t.Fatal("deployment should be ready")
+	}
+
+	deployment.Generation = 3
+	if deploymentReady(deployment) {
+		t.Fatal("deployment whose latest spec is not observed should not be ready")
+	}
+}
+
+func TestUpdateComponentStatus(t *testing.T) {
+	transition := metav1.NewTime(metav1.Now().Add(-time.Hour))
+	previous := []devicev1alpha2.ComponentStatus{
+		{Name: "edgex-redis", Ready: true, LastTransitionTime: transition},
+		{Name: "edgex-core-data", Ready: true, LastTransitionTime: transition},
+	}
+	latest := []devicev1alpha2.ComponentStatus{
+		{Name: "edgex-redis", Ready: true},
+		{Name: "edgex-core-data", Ready: false},
+		{Name: "edgex-core-metadata", Ready: false},
+	}
+
+	statuses := updateComponentStatus(previous, latest)
+	if !statuses[0].LastTransitionTime.Equal(&transition) {
+		t.Errorf("edgex-redis readiness did not change, the transition time should be kept")
+	}
+	for _, status := range statuses[1:] {
+		if !status.LastTransitionTime.After(transition.Time) {
+			t.Errorf("%s should have a new transition time", status.Name)
+		}
+	}
+}
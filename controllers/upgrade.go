@@ -0,0 +1,118 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+	"time"
+
+	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+// DefaultUpgradeTimeout is how long an upgrade may take when edgex.Spec.UpgradeTimeout is not set
+const DefaultUpgradeTimeout = 10 * time.Minute
+
+// The tiers of the components, an upgrade rolls out a tier only after the former ones are ready
+const (
+	TierInfrastructure = iota
+	TierCore
+	TierService
+)
+
+var tierNames = []string{"Infrastructure", "CoreServices", "DeviceAppServices"}
+
+// componentTier returns the tier of the component from its category, the security services
+// are relied on by the other components like the infrastructure.
+func componentTier(component *Component) int {
+	switch component.ResolvedCategory() {
+	case devicev1alpha2.CategoryInfrastructure, devicev1alpha2.CategorySecurity:
+		return TierInfrastructure
+	case devicev1alpha2.CategoryCore:
+		return TierCore
+	}
+	return TierService
+}
+
+// sortByTier sorts the components by their tier, the order within a tier is kept.
+func sortByTier(components []*Component) {
+	sort.SliceStable(components, func(i, j int) bool {
+		return componentTier(components[i]) < componentTier(components[j])
+	})
+}
+
+// planUpgrade returns the version to deploy for the edgex and the version it is upgraded from,
+// which is empty when no upgrade is in progress. The upgrade is tracked in the status of the edgex,
+// and it is rolled back to the former version once it takes longer than the timeout.
+func planUpgrade(edgex *devicev1alpha2.EdgeX, now time.Time) (version, from string) {
+	status := &edgex.Status
+	if status.Version == "" || status.Version == edgex.Spec.Version {
+		status.Version = edgex.Spec.Version
+		status.Upgrade = nil
+		return edgex.Spec.Version, ""
+	}
+
+	upgrade := status.Upgrade
+	if upgrade == nil || upgrade.FromVersion != status.Version || upgrade.ToVersion != edgex.Spec.Version {
+		upgrade = &devicev1alpha2.UpgradeStatus{
+			FromVersion: status.Version,
+			ToVersion:   edgex.Spec.Version,
+			StartTime:   metav1.NewTime(now),
+		}
+		status.Upgrade = upgrade
+	}
+
+	timeout := DefaultUpgradeTimeout
+	if edgex.Spec.UpgradeTimeout != nil {
+		timeout = edgex.Spec.UpgradeTimeout.Duration
+	}
+	if !upgrade.RolledBack && now.Sub(upgrade.StartTime.Time) > timeout {
+		upgrade.RolledBack = true
+		upgrade.Wave = ""
+	}
+	if upgrade.RolledBack {
+		conditions.MarkFalse(edgex, devicev1alpha2.UpgradeInProgressCondition, devicev1alpha2.UpgradeRolledBackReason, clusterv1.ConditionSeverityWarning,
+			"the components of %s are not ready within %s, rolled back to %s", upgrade.ToVersion, timeout, upgrade.FromVersion)
+		return upgrade.FromVersion, ""
+	}
+
+	conditions.MarkTrue(edgex, devicev1alpha2.UpgradeInProgressCondition)
+	return upgrade.ToVersion, upgrade.FromVersion
+}
+
+// completeUpgrade records the upgrade in progress as done, once all the components are ready.
+func completeUpgrade(edgex *devicev1alpha2.EdgeX) {
+	upgrade := edgex.Status.Upgrade
+	if upgrade == nil || upgrade.RolledBack {
+		return
+	}
+	edgex.Status.Version = upgrade.ToVersion
+	edgex.Status.Upgrade = nil
+	conditions.MarkFalse(edgex, devicev1alpha2.UpgradeInProgressCondition, devicev1alpha2.UpgradeSucceededReason, clusterv1.ConditionSeverityInfo,
+		"upgraded from %s to %s", upgrade.FromVersion, upgrade.ToVersion)
+}
+
+// soleOwner reports whether the pool is the only one in the yurtappset, so that
+// the template of the yurtappset can be migrated without touching the other pools.
+func soleOwner(ud *unitv1alpha1.YurtAppSet, poolName string) bool {
+	pools := ud.Spec.Topology.Pools
+	return len(pools) == 0 || (len(pools) == 1 && pools[0].Name == poolName)
+}
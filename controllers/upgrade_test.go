@@ -0,0 +1,173 @@
+/*
+Copyright 2022 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	devicev1alpha2 "github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+)
+
+func TestSortByTier(t *testing.T) {
+	components := []*Component{
+		{Name: "edgex-device-virtual"},
+		{Name: "edgex-core-data"},
+		{Name: "edgex-ui-go"},
+		{Name: "edgex-redis"},
+		{Name: "edgex-support-scheduler"},
+		{Name: "edgex-core-consul"},
+		// the category of the catalog is respected
+		{Name: "edgex-core-keeper", Category: devicev1alpha2.CategoryInfrastructure},
+	}
+	sortByTier(components)
+
+	expected := []string{"edgex-redis", "edgex-core-consul", "edgex-core-keeper", "edgex-core-data", "edgex-support-scheduler", "edgex-device-virtual", "edgex-ui-go"}
+	for i, name := range expected {
+		if components[i].Name != name {
+			t.Fatalf("expected %s at %d, got %s", name, i, components[i].Name)
+		}
+	}
+}
+
+func TestPlanUpgrade(t *testing.T) {
+	now := time.Now()
+	edgex := &devicev1alpha2.EdgeX{Spec: devicev1alpha2.EdgeXSpec{Version: "jakarta"}}
+
+	// the first deployment is not an upgrade
+	if version, from := planUpgrade(edgex, now); version != "jakarta" || from != "" {
+		t.Fatalf("unexpected plan %s from %s", version, from)
+	}
+	if edgex.Status.Version != "jakarta" {
+		t.Fatalf("unexpected status version %s", edgex.Status.Version)
+	}
+
+	edgex.Spec.Version = "kamakura"
+	if version, from := planUpgrade(edgex, now); version != "kamakura" || from != "jakarta" {
+		t.Fatalf("unexpected plan %s from %s", version, from)
+	}
+	if !conditions.IsTrue(edgex, devicev1alpha2.UpgradeInProgressCondition) {
+		t.Fatal("the upgrade should be in progress")
+	}
+
+	// the upgrade is kept until it completes
+	if version, from := planUpgrade(edgex, now.Add(time.Minute)); version != "kamakura" || from != "jakarta" {
+		t.Fatalf("unexpected plan %s from %s", version, from)
+	}
+	if !edgex.Status.Upgrade.StartTime.Equal(&metav1.Time{Time: now}) {
+		t.Fatalf("the start time should not move, got %v", edgex.Status.Upgrade.StartTime)
+	}
+
+	completeUpgrade(edgex)
+	if edgex.Status.Version != "kamakura" || edgex.Status.Upgrade != nil {
+		t.Fatalf("unexpected status after the upgrade %s %v", edgex.Status.Version, edgex.Status.Upgrade)
+	}
+	if conditions.GetReason(edgex, devicev1alpha2.UpgradeInProgressCondition) != devicev1alpha2.UpgradeSucceededReason {
+		t.Fatal("the upgrade should be succeeded")
+	}
+}
+
+func TestPlanUpgradeRollback(t *testing.T) {
+	now := time.Now()
+	edgex := &devicev1alpha2.EdgeX{
+		Spec: devicev1alpha2.EdgeXSpec{
+			Version:        "kamakura",
+			UpgradeTimeout: &metav1.Duration{Duration: time.Minute},
+		},
+		Status: devicev1alpha2.EdgeXStatus{Version: "jakarta"},
+	}
+
+	planUpgrade(edgex, now)
+	if version, from := planUpgrade(edgex, now.Add(2*time.Minute)); version != "jakarta" || from != "" {
+		t.Fatalf("the upgrade should be rolled back, got %s from %s", version, from)
+	}
+	if conditions.GetReason(edgex, devicev1alpha2.UpgradeInProgressCondition) != devicev1alpha2.UpgradeRolledBackReason {
+		t.Fatal("the upgrade should be marked as rolled back")
+	}
+
+	// completing the rolled back upgrade does not move the version
+	completeUpgrade(edgex)
+	if edgex.Status.Version != "jakarta" {
+		t.Fatalf("unexpected status version %s", edgex.Status.Version)
+	}
+
+	// a new version starts over
+	edgex.Spec.Version = "levski"
+	if version, from := planUpgrade(edgex, now.Add(3*time.Minute)); version != "levski" || from != "jakarta" {
+		t.Fatalf("unexpected plan %s from %s", version, from)
+	}
+}
+
+func TestReconcileComponentHoldBack(t *testing.T) {
+	catalog := &devicev1alpha2.VersionCatalog{Components: []Component{
+		*testComponent("edgex-core-data", "openyurt/core-data:2.1.0"),
+		*testComponent("edgex-redis", "openyurt/redis:6.2"),
+	}}
+	previous := devicev1alpha2.ComponentStatus{Name: "edgex-core-data", Ready: true, Replicas: 1, ReadyReplicas: 1, Image: "openyurt/core-data:2.0.0"}
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default", UID: "beijing"},
+		Spec:       devicev1alpha2.EdgeXSpec{PoolName: "beijing", Version: "jakarta"},
+		Status: devicev1alpha2.EdgeXStatus{
+			Version:    "hanoi",
+			Upgrade:    &devicev1alpha2.UpgradeStatus{FromVersion: "hanoi", ToVersion: "jakarta"},
+			Components: []devicev1alpha2.ComponentStatus{previous},
+		},
+	}
+	scheme := newTestScheme()
+	r := &EdgeXReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme}
+
+	if _, err := r.reconcileComponent(context.TODO(), edgex, catalog, "", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.TODO(), types.NamespacedName{Namespace: "default", Name: "edgex-core-data"}, &unitv1alpha1.YurtAppSet{}); !apierrors.IsNotFound(err) {
+		t.Fatal("edgex-core-data should be held back until edgex-redis is ready", err)
+	}
+	// the component held back keeps running the former version, so does its status
+	carried := false
+	for _, status := range edgex.Status.Components {
+		carried = carried || status == previous
+	}
+	if !carried {
+		t.Fatalf("expected the status of edgex-core-data to be carried over, got %+v", edgex.Status.Components)
+	}
+}
+
+func TestReconcileComponentError(t *testing.T) {
+	catalog := &devicev1alpha2.VersionCatalog{Components: []Component{*testComponent("edgex-core-data", "openyurt/core-data:2.1.0")}}
+	edgex := &devicev1alpha2.EdgeX{
+		ObjectMeta: metav1.ObjectMeta{Name: "edgex-beijing", Namespace: "default", UID: "beijing"},
+		Spec:       devicev1alpha2.EdgeXSpec{PoolName: "beijing"},
+	}
+	// a yurtappset the edgex cannot render its pool into
+	ud := &unitv1alpha1.YurtAppSet{ObjectMeta: metav1.ObjectMeta{Name: "edgex-core-data", Namespace: "default"}}
+	scheme := newTestScheme()
+	r := &EdgeXReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(ud).Build(), Scheme: scheme}
+
+	_, err := r.reconcileComponent(context.TODO(), edgex, catalog, "", false)
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to provision edgex-core-data of the CoreServices tier: ") {
+		t.Fatalf("expected the error to tell the component and its tier, got %v", err)
+	}
+}
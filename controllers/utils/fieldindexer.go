@@ -26,6 +26,7 @@ import (
 
 const (
 	IndexerPathForNodepool = "spec.poolName"
+	IndexerPathForVersion  = "spec.version"
 )
 
 var registerOnce sync.Once
@@ -43,6 +44,15 @@ func RegisterFieldIndexers(fi client.FieldIndexer) error {
 		}); err != nil {
 			return
 		}
+		if err = fi.IndexField(context.TODO(), &v1alpha2.EdgeX{}, IndexerPathForVersion, func(rawObj client.Object) []string {
+			edgex, ok := rawObj.(*v1alpha2.EdgeX)
+			if ok {
+				return []string{edgex.Spec.Version}
+			}
+			return []string{}
+		}); err != nil {
+			return
+		}
 	})
 
 	return err
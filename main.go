@@ -70,6 +70,7 @@ func main() {
 	var enableLeaderElection bool
 	var probeAddr string
 	var enableWebhook bool
+	var catalogNamespace string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
@@ -78,6 +79,9 @@ func main() {
 	flag.BoolVar(&enableWebhook, "enable-webhook", false,
 		"Enable webhook for controller manager. "+
 			"Enabling this will ensure edgex resource validation.")
+	flag.StringVar(&catalogNamespace, "edgex-catalog-namespace", "",
+		"The namespace of the configmaps labelled with "+controllers.LabelEdgeXCatalog+", which carry extra EdgeX version catalogs. "+
+			"They are merged over the embedded catalog and published as EdgeXVersions when changed, leave it empty to only publish the embedded catalog.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -106,19 +110,15 @@ func main() {
 		setupLog.Error(err, "Error security edgeX configuration file")
 		os.Exit(1)
 	}
-	for _, version := range edgexconfig.Versions {
-		controllers.SecurityComponents[version.Name] = version.Components
-		controllers.SecurityConfigMaps[version.Name] = version.ConfigMaps
-	}
-
 	err = json.Unmarshal(nosectyContent, &edgexnosectyconfig)
 	if err != nil {
 		setupLog.Error(err, "Error nosecty edgeX configuration file")
 		os.Exit(1)
 	}
-	for _, version := range edgexnosectyconfig.Versions {
-		controllers.NoSectyComponents[version.Name] = version.Components
-		controllers.NoSectyConfigMaps[version.Name] = version.ConfigMaps
+	manifestContent, err := edgeXconfig.ReadFile(manifestPath)
+	if err != nil {
+		setupLog.Error(err, "File to open the embed EdgeX manifest config")
+		os.Exit(1)
 	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
@@ -142,19 +142,49 @@ func main() {
 	}
 
 	if err = (&controllers.EdgeXReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:    mgr.GetClient(),
+		APIReader: mgr.GetAPIReader(),
+		Scheme:    mgr.GetScheme(),
+		Recorder:  mgr.GetEventRecorderFor("edgex-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "EdgeX")
 		os.Exit(1)
 	}
 
+	metadataSync := controllers.MetadataSync{
+		Client:   mgr.GetClient(),
+		Recorder: mgr.GetEventRecorderFor("device-controller"),
+	}
+	if err = (&controllers.DeviceServiceReconciler{MetadataSync: metadataSync}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DeviceService")
+		os.Exit(1)
+	}
+	if err = (&controllers.DeviceProfileReconciler{MetadataSync: metadataSync}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DeviceProfile")
+		os.Exit(1)
+	}
+	if err = (&controllers.DeviceReconciler{MetadataSync: metadataSync}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Device")
+		os.Exit(1)
+	}
+
+	catalogReconciler := &controllers.CatalogReconciler{
+		Client:           mgr.GetClient(),
+		Namespace:        catalogNamespace,
+		SecurityVersions: edgexconfig.Versions,
+		NoSectyVersions:  edgexnosectyconfig.Versions,
+		Manifest:         manifestContent,
+		Recorder:         mgr.GetEventRecorderFor("edgex-catalog"),
+	}
+	if enableWebhook {
+		catalogReconciler.OnReload = edgexwebhookv1alpha2.ReloadManifest
+	}
+	if err = catalogReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "EdgeXCatalog")
+		os.Exit(1)
+	}
+
 	if enableWebhook {
-		manifestContent, err := edgeXconfig.ReadFile(manifestPath)
-		if err != nil {
-			setupLog.Error(err, "File to open the embed EdgeX manifest config")
-			os.Exit(1)
-		}
 		if err = (&edgexwebhookv1alpha2.EdgeXHandler{Client: mgr.GetClient(), ManifestContent: manifestContent}).SetupWebhookWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create webhook v1alpha2", "webhook", "EdgeX")
 			os.Exit(1)
@@ -16,14 +16,19 @@ package edgex
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 
 	unitv1alpha1 "github.com/openyurtio/api/apps/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 
 	"gopkg.in/yaml.v2"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
@@ -35,18 +40,27 @@ import (
 )
 
 type Manifest struct {
-	Updated       string   `yaml:"updated"`
-	Count         int      `yaml:"count"`
-	LatestVersion string   `yaml:"latestVersion"`
-	Versions      []string `yaml:"versions"`
+	Updated       string `yaml:"updated"`
+	LatestVersion string `yaml:"latestVersion"`
+
+	// UpgradePath lists the versions from the oldest to the latest
+	UpgradePath  []string      `yaml:"upgradePath,omitempty"`
+	AllowedSkips []UpgradeSkip `yaml:"allowedSkips,omitempty"`
+
+	// ProtectedEnv lists the variables which can not be overridden by the env of an EdgeX
+	ProtectedEnv []string `yaml:"protectedEnv,omitempty"`
+}
+
+// UpgradeSkip allows an upgrade to jump over the versions between From and To in the upgrade path
+type UpgradeSkip struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
 }
 
 func NewManifest() *Manifest {
 	manifest := &Manifest{
 		Updated:       "false",
-		Count:         0,
 		LatestVersion: "",
-		Versions:      make([]string, 0),
 	}
 	return manifest
 }
@@ -67,17 +81,91 @@ func (webhook *EdgeXHandler) SetupWebhookWithManager(mgr ctrl.Manager) error {
 }
 
 func (webhook *EdgeXHandler) initManifest(manifestContent []byte) error {
+	baseManifestContent = manifestContent
+	return ReloadManifest(nil)
+}
+
+// metadataComponent holds the device inventory of the pool, it is exposed to sync the inventory to it
+const metadataComponent = "edgex-core-metadata"
+
+var (
+	manifest     = NewManifest()
+	manifestLock sync.RWMutex
+
+	// The manifest embedded in the manager, the reloaded manifests are merged over it
+	baseManifestContent []byte
+)
 
-	err := yaml.Unmarshal(manifestContent, &manifest)
+// ReloadManifest rebuilds the manifest from the embedded one and the extra manifests.
+func ReloadManifest(extraManifests [][]byte) error {
+	newManifest := NewManifest()
+	err := yaml.Unmarshal(baseManifestContent, newManifest)
 	if err != nil {
 		return fmt.Errorf("Error manifest edgeX configuration file %w", err)
 	}
+
+	for _, content := range extraManifests {
+		extra := NewManifest()
+		if err := yaml.Unmarshal(content, extra); err != nil {
+			return fmt.Errorf("Error extra manifest edgeX configuration file %w", err)
+		}
+		if extra.LatestVersion != "" {
+			newManifest.LatestVersion = extra.LatestVersion
+		}
+		if len(extra.UpgradePath) > 0 {
+			newManifest.UpgradePath = extra.UpgradePath
+		}
+		newManifest.AllowedSkips = append(newManifest.AllowedSkips, extra.AllowedSkips...)
+		newManifest.ProtectedEnv = append(newManifest.ProtectedEnv, extra.ProtectedEnv...)
+	}
+
+	manifestLock.Lock()
+	defer manifestLock.Unlock()
+	manifest = newManifest
 	return nil
 }
 
-var manifest = NewManifest()
+func currentManifest() *Manifest {
+	manifestLock.RLock()
+	defer manifestLock.RUnlock()
+	return manifest
+}
+
+// validateUpgrade checks the change of the version against the upgrade path, only the next version
+// in the path or an allowed skip is accepted. Any change is accepted when there is no upgrade path.
+func (m *Manifest) validateUpgrade(from, to string) error {
+	if from == to || len(m.UpgradePath) == 0 {
+		return nil
+	}
+
+	index := func(version string) int {
+		for i, v := range m.UpgradePath {
+			if v == version {
+				return i
+			}
+		}
+		return -1
+	}
+	fromIndex, toIndex := index(from), index(to)
+	switch {
+	case fromIndex < 0 || toIndex < 0:
+		return fmt.Errorf("no upgrade path from %s to %s", from, to)
+	case toIndex < fromIndex:
+		return fmt.Errorf("downgrade from %s to %s is not supported", from, to)
+	case toIndex == fromIndex+1:
+		return nil
+	}
+	for _, skip := range m.AllowedSkips {
+		if skip.From == from && skip.To == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("upgrade from %s to %s skips %s", from, to, strings.Join(m.UpgradePath[fromIndex+1:toIndex], ","))
+}
 
 //+kubebuilder:rbac:groups=apps.openyurt.io,resources=nodepools,verbs=list;watch
+//+kubebuilder:rbac:groups=device.openyurt.io,resources=edgexversions,verbs=get;list;watch
+//+kubebuilder:rbac:groups=device.openyurt.io,resources=devices;deviceprofiles;deviceservices,verbs=list;watch
 
 // Cluster implements a validating and defaulting webhook for Cluster.
 type EdgeXHandler struct {
@@ -101,12 +189,36 @@ func (webhook *EdgeXHandler) Default(ctx context.Context, obj runtime.Object) er
 	}
 
 	if edgex.Spec.Version == "" {
-		edgex.Spec.Version = manifest.LatestVersion
+		version, err := webhook.defaultVersion(ctx)
+		if err != nil {
+			return err
+		}
+		edgex.Spec.Version = version
 	}
 
 	return nil
 }
 
+// defaultVersion returns the EdgeXVersion marked as default, the latest version
+// of the manifest is used when no EdgeXVersion is marked.
+func (webhook *EdgeXHandler) defaultVersion(ctx context.Context) (string, error) {
+	if webhook.Client != nil {
+		versions := &v1alpha2.EdgeXVersionList{}
+		if err := webhook.Client.List(ctx, versions); err != nil {
+			return "", err
+		}
+		sort.Slice(versions.Items, func(i, j int) bool {
+			return versions.Items[i].Name < versions.Items[j].Name
+		})
+		for _, version := range versions.Items {
+			if version.Spec.Default {
+				return version.Name, nil
+			}
+		}
+	}
+	return currentManifest().LatestVersion, nil
+}
+
 // ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type.
 func (webhook *EdgeXHandler) ValidateCreate(ctx context.Context, obj runtime.Object) error {
 	edgex, ok := obj.(*v1alpha2.EdgeX)
@@ -114,7 +226,7 @@ func (webhook *EdgeXHandler) ValidateCreate(ctx context.Context, obj runtime.Obj
 		return apierrors.NewBadRequest(fmt.Sprintf("expected a Cluster but got a %T", obj))
 	}
 
-	if allErrs := webhook.validate(ctx, edgex); len(allErrs) > 0 {
+	if allErrs := webhook.validate(ctx, edgex, nil); len(allErrs) > 0 {
 		return apierrors.NewInvalid(v1alpha2.GroupVersion.WithKind("EdgeX").GroupKind(), edgex.Name, allErrs)
 	}
 
@@ -133,26 +245,52 @@ func (webhook *EdgeXHandler) ValidateUpdate(ctx context.Context, oldObj, newObj
 		return apierrors.NewBadRequest(fmt.Sprintf("expected a old Cluster but got a %T", newObj))
 	}
 
-	newErrorList := webhook.validate(ctx, newEdgex)
-	oldErrorList := webhook.validate(ctx, oldEdgex)
-	if allErrs := append(newErrorList, oldErrorList...); len(allErrs) > 0 {
+	// The edgex being deleted is only updated to release it, e.g. to remove the finalizer
+	if !newEdgex.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	allErrs := ratchetErrors(webhook.validate(ctx, newEdgex, oldEdgex), webhook.validate(ctx, oldEdgex, oldEdgex))
+	allErrs = append(allErrs, webhook.validateVersionChange(oldEdgex, newEdgex)...)
+	allErrs = append(allErrs, webhook.validateImmutableFields(oldEdgex, newEdgex)...)
+	if len(allErrs) > 0 {
 		return apierrors.NewInvalid(v1alpha2.GroupVersion.WithKind("EdgeX").GroupKind(), newEdgex.Name, allErrs)
 	}
 	return nil
 }
 
+// ratchetErrors drops the errors the old edgex already has, so that an edgex which became invalid,
+// e.g. by stricter rules, can still be updated as long as the update brings no new error.
+func ratchetErrors(errs, oldErrs field.ErrorList) field.ErrorList {
+	existing := make(map[string]struct{}, len(oldErrs))
+	for _, err := range oldErrs {
+		existing[err.Error()] = struct{}{}
+	}
+	var ratcheted field.ErrorList
+	for _, err := range errs {
+		if _, ok := existing[err.Error()]; !ok {
+			ratcheted = append(ratcheted, err)
+		}
+	}
+	return ratcheted
+}
+
 // ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type.
 func (webhook *EdgeXHandler) ValidateDelete(_ context.Context, obj runtime.Object) error {
 	return nil
 }
 
-// validate validates a EdgeX
-func (webhook *EdgeXHandler) validate(ctx context.Context, edgex *v1alpha2.EdgeX) field.ErrorList {
+// validate validates a EdgeX, oldEdgex is nil on create
+func (webhook *EdgeXHandler) validate(ctx context.Context, edgex, oldEdgex *v1alpha2.EdgeX) field.ErrorList {
 
 	// verify the version
-	if specErrs := webhook.validateEdgeXSpec(edgex); specErrs != nil {
+	if specErrs := webhook.validateEdgeXSpec(ctx, edgex, oldEdgex); specErrs != nil {
 		return specErrs
 	}
+	// verify the env
+	if envErrs := webhook.validateEdgeXEnv(edgex); envErrs != nil {
+		return envErrs
+	}
 	// verify that the poolname nodepool
 	if nodePoolErrs := webhook.validateEdgeXWithNodePools(ctx, edgex); nodePoolErrs != nil {
 		return nodePoolErrs
@@ -160,16 +298,304 @@ func (webhook *EdgeXHandler) validate(ctx context.Context, edgex *v1alpha2.EdgeX
 	return nil
 }
 
-func (webhook *EdgeXHandler) validateEdgeXSpec(edgex *v1alpha2.EdgeX) field.ErrorList {
-	for _, version := range manifest.Versions {
-		if edgex.Spec.Version == version {
+func (webhook *EdgeXHandler) validateEdgeXSpec(ctx context.Context, edgex, oldEdgex *v1alpha2.EdgeX) field.ErrorList {
+	// verify that the version is published as an EdgeXVersion
+	version := &v1alpha2.EdgeXVersion{}
+	if err := webhook.Client.Get(ctx, types.NamespacedName{Name: edgex.Spec.Version}, version); err != nil {
+		// The EdgeXVersion of an existing edgex may be deleted, the edgex is still updated
+		// without checking it against the catalog as long as it keeps the version
+		if apierrors.IsNotFound(err) && oldEdgex != nil && oldEdgex.Spec.Version == edgex.Spec.Version {
 			return nil
 		}
+		if !apierrors.IsNotFound(err) {
+			return field.ErrorList{
+				field.Invalid(field.NewPath("spec", "version"), edgex.Spec.Version, "can not get the EdgeXVersion, cause"+err.Error()),
+			}
+		}
+		versions := &v1alpha2.EdgeXVersionList{}
+		if err := webhook.Client.List(ctx, versions); err != nil {
+			return field.ErrorList{
+				field.Invalid(field.NewPath("spec", "version"), edgex.Spec.Version, "can not list EdgeXVersions, cause"+err.Error()),
+			}
+		}
+		names := make([]string, 0, len(versions.Items))
+		for _, v := range versions.Items {
+			names = append(names, v.Name)
+		}
+		sort.Strings(names)
+		return field.ErrorList{
+			field.Invalid(field.NewPath("spec", "version"), edgex.Spec.Version, "must be one of "+strings.Join(names, ",")),
+		}
+	}
+
+	// verify that the components are in the catalog of the version
+	catalog := version.Catalog(edgex.Spec.Security)
+	var errs field.ErrorList
+NextC:
+	for i, component := range edgex.Spec.Components {
+		for _, c := range catalog.Components {
+			if c.Name == component.Name {
+				continue NextC
+			}
+		}
+		errs = append(errs, field.NotFound(field.NewPath("spec", "components").Index(i).Child("name"), component.Name))
+	}
+
+	// verify the exposed components
+	if edgex.Spec.Expose != nil {
+	NextE:
+		for i, expose := range edgex.Spec.Expose.Components {
+			path := field.NewPath("spec", "expose", "components").Index(i)
+			if expose.Type == corev1.ServiceTypeClusterIP && len(expose.Ports) > 0 {
+				errs = append(errs, field.Forbidden(path.Child("ports"), "node ports can not be pinned for ClusterIP"))
+			}
+			for _, c := range catalog.Components {
+				if c.Name == expose.Name {
+					continue NextE
+				}
+			}
+			errs = append(errs, field.NotFound(path.Child("name"), expose.Name))
+		}
 	}
 
-	return field.ErrorList{
-		field.Invalid(field.NewPath("spec", "version"), edgex.Spec.Version, "must be one of"+strings.Join(manifest.Versions, ",")),
+	// verify the paths of the ingress
+	if edgex.Spec.Ingress != nil {
+	NextI:
+		for i, ingressPath := range edgex.Spec.Ingress.Paths {
+			path := field.NewPath("spec", "ingress", "paths").Index(i)
+			if !strings.HasPrefix(ingressPath.Path, "/") {
+				errs = append(errs, field.Invalid(path.Child("path"), ingressPath.Path, "must be an absolute path"))
+			}
+			for _, c := range catalog.Components {
+				if c.Name != ingressPath.Component {
+					continue
+				}
+				if c.Service == nil {
+					errs = append(errs, field.Invalid(path.Child("component"), ingressPath.Component, "has no service to route to"))
+					continue NextI
+				}
+				if !edgex.Deploys(c.Name) {
+					errs = append(errs, field.Invalid(path.Child("component"), ingressPath.Component, "is not deployed by spec.components"))
+					continue NextI
+				}
+				if ingressPath.Port == 0 {
+					continue NextI
+				}
+				for _, port := range c.Service.Ports {
+					if port.Port == ingressPath.Port {
+						continue NextI
+					}
+				}
+				errs = append(errs, field.NotFound(path.Child("port"), ingressPath.Port))
+				continue NextI
+			}
+			errs = append(errs, field.NotFound(path.Child("component"), ingressPath.Component))
+		}
+		if len(edgex.Spec.Ingress.Paths) == 0 && !routesDefaultPath(edgex, catalog) {
+			errs = append(errs, field.Required(field.NewPath("spec", "ingress", "paths"),
+				"the default path \"/\" is routed to no component deployed, set the paths"))
+		}
+	}
+
+	// verify the names of the services exposing the components
+	inventory, err := webhook.inventoryInPool(ctx, edgex)
+	if err != nil {
+		return append(errs, field.InternalError(field.NewPath("spec", "poolName"), err))
+	}
+	for _, name := range exposedComponents(edgex, catalog, inventory) {
+		if service := edgex.Name + "-" + name; len(service) > validation.DNS1035LabelMaxLength {
+			errs = append(errs, field.Invalid(field.NewPath("metadata", "name"), edgex.Name,
+				fmt.Sprintf("the service %s exposing %s must be no more than %d characters", service, name, validation.DNS1035LabelMaxLength)))
+		}
+	}
+
+	// verify the persistence of the stateful components
+	if edgex.Spec.Persistence != nil {
+	NextP:
+		for i, persistence := range edgex.Spec.Persistence.Components {
+			path := field.NewPath("spec", "persistence", "components").Index(i)
+			if persistence.Size.Sign() <= 0 {
+				errs = append(errs, field.Invalid(path.Child("size"), persistence.Size.String(), "must be greater than zero"))
+			}
+			for _, c := range catalog.Components {
+				if c.Name == persistence.Name {
+					continue NextP
+				}
+			}
+			errs = append(errs, field.NotFound(path.Child("name"), persistence.Name))
+		}
+	}
+
+	// verify the components probed by the api health check
+	if check := edgex.Spec.APIHealthCheck; check != nil {
+		path := field.NewPath("spec", "apiHealthCheck")
+		if check.Period != nil && check.Period.Duration <= 0 {
+			errs = append(errs, field.Invalid(path.Child("period"), check.Period.Duration.String(), "must be greater than zero"))
+		}
+		if check.Timeout != nil && check.Timeout.Duration <= 0 {
+			errs = append(errs, field.Invalid(path.Child("timeout"), check.Timeout.Duration.String(), "must be greater than zero"))
+		}
+	NextH:
+		for i, name := range check.Components {
+			for _, c := range catalog.Components {
+				if c.Name != name {
+					continue
+				}
+				if c.Service == nil || len(c.Service.Ports) == 0 {
+					errs = append(errs, field.Invalid(path.Child("components").Index(i), name, "has no service to probe"))
+				}
+				continue NextH
+			}
+			errs = append(errs, field.NotFound(path.Child("components").Index(i), name))
+		}
+	}
+	return errs
+}
+
+// inventoryInPool reports whether a device, a device profile or a device service is bound to the pool of the edgex.
+func (webhook *EdgeXHandler) inventoryInPool(ctx context.Context, edgex *v1alpha2.EdgeX) (bool, error) {
+	devices := &v1alpha2.DeviceList{}
+	if err := webhook.Client.List(ctx, devices, client.InNamespace(edgex.Namespace)); err != nil {
+		return false, err
+	}
+	for _, device := range devices.Items {
+		if device.Spec.PoolName == edgex.Spec.PoolName {
+			return true, nil
+		}
+	}
+	profiles := &v1alpha2.DeviceProfileList{}
+	if err := webhook.Client.List(ctx, profiles, client.InNamespace(edgex.Namespace)); err != nil {
+		return false, err
+	}
+	for _, profile := range profiles.Items {
+		if profile.Spec.PoolName == edgex.Spec.PoolName {
+			return true, nil
+		}
+	}
+	services := &v1alpha2.DeviceServiceList{}
+	if err := webhook.Client.List(ctx, services, client.InNamespace(edgex.Namespace)); err != nil {
+		return false, err
+	}
+	for _, service := range services.Items {
+		if service.Spec.PoolName == edgex.Spec.PoolName {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// exposedComponents returns the components of the catalog which may be exposed by a service named after
+// the edgex: the ones exposed by spec.expose, routed by the ingress or probed by the API health check,
+// and core-metadata when the pool has a device inventory to sync to it.
+func exposedComponents(edgex *v1alpha2.EdgeX, catalog *v1alpha2.VersionCatalog, inventory bool) []string {
+	exposed := make(map[string]bool)
+	if expose := edgex.Spec.Expose; expose != nil {
+		for _, c := range expose.Components {
+			exposed[c.Name] = true
+		}
+	}
+	if ingress := edgex.Spec.Ingress; ingress != nil {
+		paths := ingress.Paths
+		if len(paths) == 0 {
+			paths = v1alpha2.DefaultIngressPaths(edgex.Spec.Security)
+		}
+		for _, path := range paths {
+			exposed[path.Component] = true
+		}
+	}
+	if check := edgex.Spec.APIHealthCheck; check != nil {
+		for _, name := range check.Components {
+			exposed[name] = true
+		}
+	}
+
+	var names []string
+	for i := range catalog.Components {
+		c := &catalog.Components[i]
+		if c.Service == nil || !edgex.Deploys(c.Name) {
+			continue
+		}
+		switch {
+		case exposed[c.Name], inventory && c.Name == metadataComponent,
+			edgex.Spec.Expose != nil && edgex.Spec.Expose.Type != "",
+			edgex.Spec.APIHealthCheck != nil && len(edgex.Spec.APIHealthCheck.Components) == 0 && c.ResolvedCategory() == v1alpha2.CategoryCore:
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// routesDefaultPath reports whether a default path of the ingress is routed to a component deployed.
+func routesDefaultPath(edgex *v1alpha2.EdgeX, catalog *v1alpha2.VersionCatalog) bool {
+	for _, path := range v1alpha2.DefaultIngressPaths(edgex.Spec.Security) {
+		for _, c := range catalog.Components {
+			if c.Name == path.Component && c.Service != nil && len(c.Service.Ports) > 0 && edgex.Deploys(c.Name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateEdgeXEnv rejects the variables protected by the manifest, and the global variables
+// which are not plain values since they are written into the configmap.
+func (webhook *EdgeXHandler) validateEdgeXEnv(edgex *v1alpha2.EdgeX) field.ErrorList {
+	protected := make(map[string]struct{})
+	for _, name := range currentManifest().ProtectedEnv {
+		protected[name] = struct{}{}
+	}
+
+	var errs field.ErrorList
+	validate := func(path *field.Path, env []corev1.EnvVar, plain bool) {
+		for i, e := range env {
+			if _, ok := protected[e.Name]; ok {
+				errs = append(errs, field.Forbidden(path.Index(i).Child("name"), fmt.Sprintf("%s is protected and can not be overridden", e.Name)))
+			}
+			if plain && e.ValueFrom != nil {
+				errs = append(errs, field.Forbidden(path.Index(i).Child("valueFrom"), "only value is supported"))
+			}
+		}
+	}
+	validate(field.NewPath("spec", "env"), edgex.Spec.Env, true)
+	for i, component := range edgex.Spec.Components {
+		validate(field.NewPath("spec", "components").Index(i).Child("env"), component.Env, false)
+	}
+	return errs
+}
+
+// validateVersionChange rejects the downgrades and the jumps out of the upgrade path,
+// unless the override annotation is set on the new edgex. The path starts from the version
+// running in the pool, so that going back to it after a rollback is accepted.
+func (webhook *EdgeXHandler) validateVersionChange(oldEdgex, newEdgex *v1alpha2.EdgeX) field.ErrorList {
+	if newEdgex.Annotations[v1alpha2.AnnotationOverrideUpgradePath] == "true" || oldEdgex.Spec.Version == newEdgex.Spec.Version {
+		return nil
+	}
+	from := oldEdgex.Spec.Version
+	if oldEdgex.Status.Version != "" {
+		from = oldEdgex.Status.Version
+	}
+	if err := currentManifest().validateUpgrade(from, newEdgex.Spec.Version); err != nil {
+		return field.ErrorList{
+			field.Forbidden(field.NewPath("spec", "version"),
+				fmt.Sprintf("%s, set the annotation %s to \"true\" to force it", err.Error(), v1alpha2.AnnotationOverrideUpgradePath)),
+		}
+	}
+	return nil
+}
+
+// validateImmutableFields rejects the changes of the pool and the security mode, the components
+// of an edgex are bound to both of them and they can not be migrated in place.
+func (webhook *EdgeXHandler) validateImmutableFields(oldEdgex, newEdgex *v1alpha2.EdgeX) field.ErrorList {
+	var errs field.ErrorList
+	if oldEdgex.Spec.PoolName != newEdgex.Spec.PoolName {
+		errs = append(errs, field.Invalid(field.NewPath("spec", "poolName"), newEdgex.Spec.PoolName,
+			"is immutable, delete the edgex and create one in the new pool instead"))
+	}
+	if oldEdgex.Spec.Security != newEdgex.Spec.Security {
+		errs = append(errs, field.Invalid(field.NewPath("spec", "security"), newEdgex.Spec.Security,
+			"is immutable, delete the edgex and create a new one instead"))
 	}
+	return errs
 }
 
 func (webhook *EdgeXHandler) validateEdgeXWithNodePools(ctx context.Context, edgex *v1alpha2.EdgeX) field.ErrorList {
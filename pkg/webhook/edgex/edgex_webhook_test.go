@@ -16,12 +16,15 @@ package edgex
 import (
 	"context"
 	"io/ioutil"
+	"strings"
 	"testing"
 
 	v1 "github.com/openyurtio/api/apps/v1alpha1"
 	"github.com/openyurtio/yurt-edgex-manager/api/v1alpha2"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -39,6 +42,30 @@ var defaultEdgeX = &v1alpha2.EdgeX{
 	},
 }
 
+// testVersions returns the EdgeXVersions published for the tests
+func testVersions() []client.Object {
+	return []client.Object{
+		&v1alpha2.EdgeXVersion{
+			ObjectMeta: metav1.ObjectMeta{Name: "levski"},
+			Spec: v1alpha2.EdgeXVersionSpec{
+				NoSecty: v1alpha2.VersionCatalog{Components: []v1alpha2.VersionComponent{
+					{Name: "edgex-redis"},
+					{Name: "edgex-core-data"},
+					{Name: "edgex-core-metadata", Service: &corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 59881}}}},
+					{Name: "edgex-ui-go", Service: &corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 4000}}}},
+				}},
+			},
+		},
+		&v1alpha2.EdgeXVersion{
+			ObjectMeta: metav1.ObjectMeta{Name: "jakarta"},
+			Spec: v1alpha2.EdgeXVersionSpec{
+				Default: true,
+				NoSecty: v1alpha2.VersionCatalog{Components: []v1alpha2.VersionComponent{{Name: "edgex-redis"}}},
+			},
+		},
+	}
+}
+
 func TestEdgeXDefaulter(t *testing.T) {
 	webhook := &EdgeXHandler{}
 	manifestPath := "../../../EdgeXConfig/manifest.yaml"
@@ -76,7 +103,7 @@ func TestEdgeXValidator(t *testing.T) {
 		},
 		Spec: v1.NodePoolSpec{},
 	}
-	objs := []client.Object{beijingNodePool, hangzhouNodePool}
+	objs := append(testVersions(), beijingNodePool, hangzhouNodePool)
 	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
 	webhook := &EdgeXHandler{Client: client}
 
@@ -90,17 +117,109 @@ func TestEdgeXValidator(t *testing.T) {
 	}
 
 	// set default value
+	defaultEdgeX.Spec.Version = ""
 	if err := webhook.Default(context.TODO(), defaultEdgeX); err != nil {
 		t.Fatal(err)
 	}
 
+	if defaultEdgeX.Spec.Version != "jakarta" {
+		t.Fatalf("expected the default EdgeXVersion jakarta, got %s", defaultEdgeX.Spec.Version)
+	}
+
 	//validate edgex's version
-	// defaultEdgeX.Spec.Version = "testing"
-	// if err := webhook.ValidateCreate(context.TODO(), defaultEdgeX); err == nil {
-	// 	t.Fatal("edgex should create fail", err)
-	// }
+	unknown := defaultEdgeX.DeepCopy()
+	unknown.Spec.Version = "testing"
+	if err := webhook.ValidateCreate(context.TODO(), unknown); err == nil {
+		t.Fatal("edgex should create fail", err)
+	}
+
+	//validate edgex's components
+	unknown.Spec.Version = "jakarta"
+	unknown.Spec.Components = []v1alpha2.Component{{Name: "edgex-core-data"}}
+	if err := webhook.ValidateCreate(context.TODO(), unknown); err == nil {
+		t.Fatal("edgex should create fail", err)
+	}
+	unknown.Spec.Version = "levski"
+	if err := webhook.ValidateCreate(context.TODO(), unknown); err != nil {
+		t.Fatal("edgex should create success", err)
+	}
+
+	//validate edgex's ingress
+	unknown.Spec.Ingress = &v1alpha2.Ingress{Paths: []v1alpha2.IngressPath{{Path: "/", Component: "edgex-kuiper"}}}
+	if err := webhook.ValidateCreate(context.TODO(), unknown); err == nil {
+		t.Fatal("edgex should create fail with an ingress to an unknown component", err)
+	}
+	unknown.Spec.Components = append(unknown.Spec.Components, v1alpha2.Component{Name: "edgex-ui-go", Enabled: pointer.BoolPtr(false)})
+	unknown.Spec.Ingress.Paths[0].Component = "edgex-ui-go"
+	if err := webhook.ValidateCreate(context.TODO(), unknown); err == nil {
+		t.Fatal("edgex should create fail with an ingress to a component not deployed", err)
+	}
+	unknown.Spec.Ingress.Paths = nil
+	if err := webhook.ValidateCreate(context.TODO(), unknown); err == nil {
+		t.Fatal("edgex should create fail with the default ingress to a component not deployed", err)
+	}
+	unknown.Spec.Components[1].Enabled = pointer.BoolPtr(true)
+	if err := webhook.ValidateCreate(context.TODO(), unknown); err != nil {
+		t.Fatal("edgex should create success with the default ingress", err)
+	}
+	unknown.Spec.Components = unknown.Spec.Components[:1]
+	unknown.Spec.Ingress = nil
+
+	//validate the names of the exposed services
+	long := unknown.DeepCopy()
+	long.Name = "edgex-" + strings.Repeat("a", 48)
+	long.Spec.Components = nil
+	if err := webhook.ValidateCreate(context.TODO(), long); err != nil {
+		t.Fatal("edgex should create success without exposed services", err)
+	}
+	long.Spec.Expose = &v1alpha2.Expose{Type: corev1.ServiceTypeNodePort}
+	if err := webhook.ValidateCreate(context.TODO(), long); err == nil {
+		t.Fatal("edgex should create fail with too long exposed services", err)
+	}
+	long.Spec.Expose = nil
+	long.Spec.Ingress = &v1alpha2.Ingress{}
+	if err := webhook.ValidateCreate(context.TODO(), long); err == nil {
+		t.Fatal("edgex should create fail with a too long service routed by the ingress", err)
+	}
+	long.Spec.Ingress = nil
+
+	// core-metadata is only exposed once the pool has a device inventory
+	device := &v1alpha2.Device{
+		ObjectMeta: metav1.ObjectMeta{Name: "sensor", Namespace: "default"},
+		Spec:       v1alpha2.DeviceSpec{PoolName: "beijing"},
+	}
+	if err := client.Create(context.TODO(), device); err != nil {
+		t.Fatal(err)
+	}
+	if err := webhook.ValidateCreate(context.TODO(), long); err == nil {
+		t.Fatal("edgex should create fail with a too long service exposing core-metadata", err)
+	}
+	// the existing edgex is updated as long as the update brings no new error, and always once deleted
+	updated := long.DeepCopy()
+	updated.Spec.ImageRegistry = "registry.local:5000"
+	if err := webhook.ValidateUpdate(context.TODO(), long, updated); err != nil {
+		t.Fatal("edgex should update success with the errors it already has", err)
+	}
+	updated.Spec.Expose = &v1alpha2.Expose{Type: corev1.ServiceTypeNodePort}
+	if err := webhook.ValidateUpdate(context.TODO(), long, updated); err == nil {
+		t.Fatal("edgex should update fail with new too long exposed services", err)
+	}
+	now := metav1.Now()
+	updated.DeletionTimestamp = &now
+	if err := webhook.ValidateUpdate(context.TODO(), long, updated); err != nil {
+		t.Fatal("edgex should update success once deleted", err)
+	}
+	if err := client.Delete(context.TODO(), device); err != nil {
+		t.Fatal(err)
+	}
+
+	//validate edgex's api health check
+	unknown.Spec.APIHealthCheck = &v1alpha2.APIHealthCheck{Components: []string{"edgex-support-scheduler"}}
+	if err := webhook.ValidateCreate(context.TODO(), unknown); err == nil {
+		t.Fatal("edgex should create fail with a probe of an unknown component", err)
+	}
+	unknown.Spec.APIHealthCheck = nil
 
-	// defaultEdgeX.Spec.Version = "levski"
 	if err := webhook.ValidateCreate(context.TODO(), defaultEdgeX); err != nil {
 		t.Fatal("edgex should create success", err)
 	}
@@ -111,13 +230,44 @@ func TestEdgeXValidator(t *testing.T) {
 	EdgeX2.Spec.Version = "jakarta"
 	EdgeX2.Spec.PoolName = "hangzhou"
 
-	if err := webhook.ValidateUpdate(context.TODO(), defaultEdgeX, EdgeX2); err != nil {
-		t.Fatal("edgex should update success", err)
+	if err := webhook.ValidateCreate(context.TODO(), EdgeX2); err != nil {
+		t.Fatal("edgex should create success", err)
 	}
 
 	EdgeX2.Spec.PoolName = "shanghai"
-	if err := webhook.ValidateUpdate(context.TODO(), defaultEdgeX, EdgeX2); err == nil {
-		t.Fatal("edgex should update fail", err)
+	if err := webhook.ValidateCreate(context.TODO(), EdgeX2); err == nil {
+		t.Fatal("edgex should create fail", err)
+	}
+
+	//validate the immutable fields
+	EdgeX3 := defaultEdgeX.DeepCopy()
+	EdgeX3.Spec.PoolName = "hangzhou"
+	if err := webhook.ValidateUpdate(context.TODO(), defaultEdgeX, EdgeX3); err == nil {
+		t.Fatal("edgex should update fail with a new poolName", err)
+	}
+	EdgeX3 = defaultEdgeX.DeepCopy()
+	EdgeX3.Spec.Security = true
+	if err := webhook.ValidateUpdate(context.TODO(), defaultEdgeX, EdgeX3); err == nil {
+		t.Fatal("edgex should update fail with a new security", err)
+	}
+	EdgeX3 = defaultEdgeX.DeepCopy()
+	EdgeX3.Spec.ImageRegistry = "registry.local:5000"
+	if err := webhook.ValidateUpdate(context.TODO(), defaultEdgeX, EdgeX3); err != nil {
+		t.Fatal("edgex should update success", err)
+	}
+
+	// the edgex of a deleted EdgeXVersion is still updated as long as it keeps the version
+	retired := defaultEdgeX.DeepCopy()
+	retired.Spec.Version = "ireland"
+	EdgeX3 = retired.DeepCopy()
+	EdgeX3.Spec.ImageRegistry = "registry.local:5000"
+	if err := webhook.ValidateUpdate(context.TODO(), retired, EdgeX3); err != nil {
+		t.Fatal("edgex should update success with its deleted version", err)
+	}
+	EdgeX3.Spec.Version = "hanoi"
+	EdgeX3.Annotations = map[string]string{v1alpha2.AnnotationOverrideUpgradePath: "true"}
+	if err := webhook.ValidateUpdate(context.TODO(), retired, EdgeX3); err == nil {
+		t.Fatal("edgex should update fail with a new version not published", err)
 	}
 
 	objs = append(objs, defaultEdgeX)
@@ -129,3 +279,115 @@ func TestEdgeXValidator(t *testing.T) {
 	}
 
 }
+
+func TestReloadManifest(t *testing.T) {
+	webhook := &EdgeXHandler{}
+	manifestContent, err := ioutil.ReadFile("../../../EdgeXConfig/manifest.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := webhook.initManifest(manifestContent); err != nil {
+		t.Fatal(err)
+	}
+	defer webhook.initManifest(manifestContent)
+
+	extra := []byte("latestVersion: minnesota\n")
+	if err := ReloadManifest([][]byte{extra}); err != nil {
+		t.Fatal(err)
+	}
+
+	edgex := defaultEdgeX.DeepCopy()
+	edgex.Spec.Version = ""
+	if err := webhook.Default(context.TODO(), edgex); err != nil {
+		t.Fatal(err)
+	}
+	if edgex.Spec.Version != "minnesota" {
+		t.Fatalf("expected the latest version from the extra manifest, got %s", edgex.Spec.Version)
+	}
+}
+
+func TestValidateVersionChange(t *testing.T) {
+	webhook := &EdgeXHandler{}
+	manifestContent, err := ioutil.ReadFile("../../../EdgeXConfig/manifest.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := webhook.initManifest(manifestContent); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		from  string
+		to    string
+		valid bool
+	}{
+		{"jakarta", "jakarta", true},
+		{"jakarta", "kamakura", true},
+		{"jakarta", "levski", true},
+		{"ireland", "levski", false},
+		{"levski", "hanoi", false},
+		{"levski", "minnesota", false},
+	}
+	for _, c := range cases {
+		oldEdgex := defaultEdgeX.DeepCopy()
+		oldEdgex.Spec.Version = c.from
+		newEdgex := defaultEdgeX.DeepCopy()
+		newEdgex.Spec.Version = c.to
+		if errs := webhook.validateVersionChange(oldEdgex, newEdgex); (len(errs) == 0) != c.valid {
+			t.Errorf("change from %s to %s: expected valid %v, got %v", c.from, c.to, c.valid, errs)
+		}
+	}
+
+	// the path starts from the version running in the pool, which can be set back after a rollback
+	rolledBack := defaultEdgeX.DeepCopy()
+	rolledBack.Spec.Version = "jakarta"
+	rolledBack.Status.Version = "ireland"
+	for to, valid := range map[string]bool{"ireland": true, "jakarta": true, "kamakura": false} {
+		newEdgex := defaultEdgeX.DeepCopy()
+		newEdgex.Spec.Version = to
+		if errs := webhook.validateVersionChange(rolledBack, newEdgex); (len(errs) == 0) != valid {
+			t.Errorf("change from the running ireland to %s: expected valid %v, got %v", to, valid, errs)
+		}
+	}
+
+	// the override annotation forces a downgrade
+	oldEdgex := defaultEdgeX.DeepCopy()
+	oldEdgex.Spec.Version = "levski"
+	newEdgex := defaultEdgeX.DeepCopy()
+	newEdgex.Spec.Version = "hanoi"
+	newEdgex.Annotations = map[string]string{v1alpha2.AnnotationOverrideUpgradePath: "true"}
+	if errs := webhook.validateVersionChange(oldEdgex, newEdgex); errs != nil {
+		t.Errorf("the downgrade should be forced, got %v", errs)
+	}
+}
+
+func TestValidateEdgeXEnv(t *testing.T) {
+	webhook := &EdgeXHandler{}
+	manifestContent, err := ioutil.ReadFile("../../../EdgeXConfig/manifest.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := webhook.initManifest(manifestContent); err != nil {
+		t.Fatal(err)
+	}
+
+	edgex := defaultEdgeX.DeepCopy()
+	edgex.Spec.Env = []corev1.EnvVar{{Name: "STAGEGATE_WAITFOR_TIMEOUT", Value: "120s"}}
+	edgex.Spec.Components = []v1alpha2.Component{{
+		Name: "edgex-core-data",
+		Env: []corev1.EnvVar{{Name: "WRITABLE_LOGLEVEL", ValueFrom: &corev1.EnvVarSource{
+			ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "log"}, Key: "level"},
+		}}},
+	}}
+	if errs := webhook.validateEdgeXEnv(edgex); errs != nil {
+		t.Fatalf("env should be valid, got %v", errs)
+	}
+
+	edgex.Spec.Env = append(edgex.Spec.Env,
+		corev1.EnvVar{Name: "EDGEX_SECURITY_SECRET_STORE", Value: "false"},
+		corev1.EnvVar{Name: "MESSAGEQUEUE_HOST", ValueFrom: &corev1.EnvVarSource{}})
+	edgex.Spec.Components[0].Env = append(edgex.Spec.Components[0].Env, corev1.EnvVar{Name: "SERVICE_HOST", Value: "core-data"})
+	if errs := webhook.validateEdgeXEnv(edgex); len(errs) != 3 {
+		t.Fatalf("expected 3 errors, got %v", errs)
+	}
+}